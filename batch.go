@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/fault"
+)
+
+// batchWriter writes products to the store in fixed-size chunks, retrying
+// transient failures with exponential backoff and keeping track of every
+// object that still failed.
+type batchWriter struct {
+	target     VectorStore
+	chunkSize  int
+	maxRetries int
+	backoff    time.Duration
+}
+
+// WriteSummary is the outcome of writing a set of products.
+type WriteSummary struct {
+	Total    int           `json:"total"`
+	Inserted int           `json:"inserted"`
+	Failed   int           `json:"failed"`
+	Errors   []ObjectError `json:"errors"`
+}
+
+func newBatchWriter() *batchWriter {
+	backoff, err := time.ParseDuration(getEnv("INGEST_RETRY_BACKOFF", "500ms"))
+	if err != nil {
+		log.Printf("Invalid INGEST_RETRY_BACKOFF: %v, using 500ms", err)
+		backoff = 500 * time.Millisecond
+	}
+
+	w := &batchWriter{
+		target:     store,
+		chunkSize:  getEnvInt("INGEST_BATCH_SIZE", 100),
+		maxRetries: getEnvInt("INGEST_MAX_RETRIES", 3),
+		backoff:    backoff,
+	}
+	if w.chunkSize <= 0 {
+		w.chunkSize = 100
+	}
+	if w.maxRetries < 0 {
+		w.maxRetries = 0
+	}
+	return w
+}
+
+// write stores products chunk by chunk. onChunk, if set, is called after each
+// chunk with its size and the objects in it that failed for good.
+func (w *batchWriter) write(ctx context.Context, products []Product, onChunk func(size int, failed []ObjectError)) WriteSummary {
+	summary := WriteSummary{Total: len(products), Errors: []ObjectError{}}
+
+	for start := 0; start < len(products); start += w.chunkSize {
+		end := start + w.chunkSize
+		if end > len(products) {
+			end = len(products)
+		}
+		chunk := products[start:end]
+
+		failed := w.writeChunk(ctx, chunk)
+		summary.Inserted += len(chunk) - len(failed)
+		summary.Failed += len(failed)
+		summary.Errors = append(summary.Errors, failed...)
+		if onChunk != nil {
+			onChunk(len(chunk), failed)
+		}
+	}
+	return summary
+}
+
+// writeChunk writes one chunk, resubmitting only the objects that failed
+// transiently, and returns the objects that never made it.
+func (w *batchWriter) writeChunk(ctx context.Context, chunk []Product) []ObjectError {
+	pending := chunk
+	var failed []ObjectError
+
+	for attempt := 0; ; attempt++ {
+		objectErrors, err := w.upsert(ctx, pending)
+		if err != nil {
+			// The whole request failed, so every product in it did.
+			objectErrors = make([]ObjectError, len(pending))
+			for i, product := range pending {
+				objectErrors[i] = ObjectError{ID: productKey(product), Name: product.Name, Message: err.Error()}
+			}
+			if !isTransientError(err) {
+				return append(failed, objectErrors...)
+			}
+		}
+		if len(objectErrors) == 0 {
+			return failed
+		}
+
+		// Permanent failures (e.g. invalid properties) are final; transient
+		// ones get another attempt.
+		retry := []Product{}
+		var retryErrors []ObjectError
+		byID := make(map[string]Product, len(pending))
+		for _, product := range pending {
+			byID[productKey(product)] = product
+		}
+		for _, objectError := range objectErrors {
+			product, ok := byID[objectError.ID]
+			if ok && (err != nil || isTransientMessage(objectError.Message)) {
+				retry = append(retry, product)
+				retryErrors = append(retryErrors, objectError)
+			} else {
+				failed = append(failed, objectError)
+			}
+		}
+
+		if len(retry) == 0 {
+			return failed
+		}
+		if attempt >= w.maxRetries || ctx.Err() != nil {
+			return append(failed, retryErrors...)
+		}
+
+		delay := w.backoff << attempt
+		log.Printf("Retrying %d of %d products in %v (attempt %d of %d)", len(retry), len(chunk), delay, attempt+1, w.maxRetries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return append(failed, retryErrors...)
+		}
+		pending = retry
+	}
+}
+
+func (w *batchWriter) upsert(ctx context.Context, products []Product) ([]ObjectError, error) {
+	if err := stampTimestamps(ctx, w.target, products); err != nil {
+		return nil, err
+	}
+	return w.target.Upsert(ctx, products)
+}
+
+// productKey is the ID a product is stored under.
+func productKey(p Product) string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return productID(p)
+}
+
+// isTransientError reports whether a failed request is worth retrying:
+// network failures, rate limiting and server errors are; client errors such
+// as an invalid schema, and anything else we cannot classify, are not.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var clientErr *fault.WeaviateClientError
+	if errors.As(err, &clientErr) {
+		if clientErr.IsUnexpectedStatusCode {
+			return isTransientStatus(clientErr.StatusCode)
+		}
+		// The client does not wrap its cause, so look at it directly.
+		err = clientErr.DerivedFromError
+	}
+	var embedErr *embedderStatusError
+	if errors.As(err, &embedErr) {
+		return isTransientStatus(embedErr.StatusCode)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// transientMarkers are substrings of per-object error messages that point at
+// a temporary condition rather than a bad object.
+var transientMarkers = []string{
+	"timeout", "deadline exceeded", "connection", "unavailable",
+	"too many requests", "rate limit", "try again",
+}
+
+func isTransientMessage(message string) bool {
+	message = strings.ToLower(message)
+	for _, marker := range transientMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
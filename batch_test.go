@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/fault"
+)
+
+// flakyStore fails writes as scripted and records which products each write
+// attempt carried. Products that do not fail are written to the memory store.
+type flakyStore struct {
+	*memoryStore
+	// requestErrors fail whole writes, one per attempt, until they run out.
+	requestErrors []error
+	// objectErrors fail single products by name, one message per attempt,
+	// until they run out.
+	objectErrors map[string][]string
+	attempts     [][]string
+}
+
+func (s *flakyStore) Upsert(ctx context.Context, products []Product) ([]ObjectError, error) {
+	s.attempts = append(s.attempts, productNames(products))
+	if len(s.requestErrors) > 0 {
+		err := s.requestErrors[0]
+		s.requestErrors = s.requestErrors[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var written []Product
+	var failed []ObjectError
+	for _, p := range products {
+		if messages := s.objectErrors[p.Name]; len(messages) > 0 {
+			s.objectErrors[p.Name] = messages[1:]
+			failed = append(failed, ObjectError{ID: productKey(p), Name: p.Name, Message: messages[0]})
+			continue
+		}
+		written = append(written, p)
+	}
+	if _, err := s.memoryStore.Upsert(ctx, written); err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+func useFlakyStore(t *testing.T, s *flakyStore) {
+	t.Helper()
+	s.memoryStore = newMemoryStore(newLocalEmbedder(0))
+	previous := store
+	store = s
+	t.Cleanup(func() { store = previous })
+}
+
+func TestBatchWriterWriteChunk(t *testing.T) {
+	unavailable := &fault.WeaviateClientError{IsUnexpectedStatusCode: true, StatusCode: http.StatusServiceUnavailable, Msg: "unavailable"}
+	unprocessable := &fault.WeaviateClientError{IsUnexpectedStatusCode: true, StatusCode: http.StatusUnprocessableEntity, Msg: "invalid class"}
+
+	tests := []struct {
+		name          string
+		requestErrors []error
+		objectErrors  map[string][]string
+		// attempts lists the products sent by each write; failed lists the
+		// products reported as failed for good.
+		attempts [][]string
+		failed   []string
+	}{
+		{
+			name:     "all written",
+			attempts: [][]string{{"A", "B", "C"}},
+		},
+		{
+			name:         "only transient object failures are retried",
+			objectErrors: map[string][]string{"B": {"connection reset by peer"}, "C": {"invalid property price"}},
+			attempts:     [][]string{{"A", "B", "C"}, {"B"}},
+			failed:       []string{"C"},
+		},
+		{
+			name:         "retries run out",
+			objectErrors: map[string][]string{"A": {"timeout", "timeout", "timeout"}},
+			attempts:     [][]string{{"A", "B", "C"}, {"A"}, {"A"}},
+			failed:       []string{"A"},
+		},
+		{
+			name:          "transient request failure retries everything",
+			requestErrors: []error{unavailable},
+			attempts:      [][]string{{"A", "B", "C"}, {"A", "B", "C"}},
+		},
+		{
+			name:          "permanent request failure is not retried",
+			requestErrors: []error{unprocessable},
+			attempts:      [][]string{{"A", "B", "C"}},
+			failed:        []string{"A", "B", "C"},
+		},
+		{
+			name:          "canceled request is not retried",
+			requestErrors: []error{context.Canceled},
+			attempts:      [][]string{{"A", "B", "C"}},
+			failed:        []string{"A", "B", "C"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &flakyStore{requestErrors: tt.requestErrors, objectErrors: tt.objectErrors}
+			useFlakyStore(t, s)
+			w := &batchWriter{target: s, chunkSize: 10, maxRetries: 2}
+
+			failed := w.writeChunk(context.Background(), []Product{{Name: "A"}, {Name: "B"}, {Name: "C"}})
+			if !reflect.DeepEqual(s.attempts, tt.attempts) {
+				t.Errorf("attempts %v, want %v", s.attempts, tt.attempts)
+			}
+			var failedNames []string
+			for _, objectError := range failed {
+				failedNames = append(failedNames, objectError.Name)
+			}
+			if !reflect.DeepEqual(failedNames, tt.failed) {
+				t.Errorf("failed %v, want %v", failedNames, tt.failed)
+			}
+			if count, _ := s.Count(context.Background(), nil); count != 3-len(tt.failed) {
+				t.Errorf("%d products written, want %d", count, 3-len(tt.failed))
+			}
+		})
+	}
+}
+
+func TestBatchWriterWrite(t *testing.T) {
+	s := &flakyStore{objectErrors: map[string][]string{"D": {"invalid property price"}}}
+	useFlakyStore(t, s)
+	w := &batchWriter{target: s, chunkSize: 2, maxRetries: 2}
+
+	var chunks []int
+	summary := w.write(context.Background(), []Product{{Name: "A"}, {Name: "B"}, {Name: "C"}, {Name: "D"}, {Name: "E"}}, func(size int, failed []ObjectError) {
+		chunks = append(chunks, size)
+	})
+
+	if want := []int{2, 2, 1}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunk sizes %v, want %v", chunks, want)
+	}
+	if summary.Total != 5 || summary.Inserted != 4 || summary.Failed != 1 || len(summary.Errors) != 1 || summary.Errors[0].Name != "D" {
+		t.Errorf("summary %+v, want D failed and the rest inserted", summary)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "http://localhost:8080", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &fault.WeaviateClientError{IsUnexpectedStatusCode: true, StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", &fault.WeaviateClientError{IsUnexpectedStatusCode: true, StatusCode: http.StatusBadGateway}, true},
+		{"client error", &fault.WeaviateClientError{IsUnexpectedStatusCode: true, StatusCode: http.StatusUnprocessableEntity}, false},
+		{"network error", &fault.WeaviateClientError{StatusCode: -1, DerivedFromError: refused}, true},
+		{"undecodable response", &fault.WeaviateClientError{StatusCode: -1, DerivedFromError: errors.New("unexpected end of JSON input")}, false},
+		{"embedder rate limited", fmt.Errorf("embedding products: %w", &embedderStatusError{StatusCode: http.StatusTooManyRequests}), true},
+		{"embedder unavailable", fmt.Errorf("embedding products: %w", &embedderStatusError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"embedder rejected input", fmt.Errorf("embedding products: %w", &embedderStatusError{StatusCode: http.StatusBadRequest}), false},
+		{"embedder unreachable", fmt.Errorf("embedding products: %w", refused), true},
+		{"wrong vector count", errors.New("embedder returned 1 vectors for 2 products"), false},
+		{"canceled", context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.want {
+				t.Errorf("isTransientError(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
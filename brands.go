@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// knownBrands are the brands recognized in search queries and inferred from
+// product names. QUERY_BRANDS adds catalog-specific ones; read it through
+// brands().
+var knownBrands = []string{
+	"Acer", "Amazon", "Apple", "Asus", "Bose", "Canon", "Dell", "Dyson",
+	"Fitbit", "Fujifilm", "Garmin", "GoPro", "Google", "HP", "iRobot",
+	"JBL", "KitchenAid", "Lenovo", "LG", "Logitech", "Microsoft", "Nikon",
+	"Nintendo", "OnePlus", "Peloton", "Razer", "Samsung", "Sennheiser",
+	"Sony", "Tesla", "Xiaomi",
+}
+
+// productLines map product line names that are used without the brand, as in
+// "iPhone 15", to the brand.
+var productLines = map[string]string{
+	"airpods":     "Apple",
+	"alienware":   "Dell",
+	"galaxy":      "Samsung",
+	"imac":        "Apple",
+	"ipad":        "Apple",
+	"iphone":      "Apple",
+	"kindle":      "Amazon",
+	"macbook":     "Apple",
+	"pixel":       "Google",
+	"playstation": "Sony",
+	"roomba":      "iRobot",
+	"surface":     "Microsoft",
+	"thinkpad":    "Lenovo",
+	"xbox":        "Microsoft",
+	"xps":         "Dell",
+}
+
+var brandsOnce sync.Once
+
+// brands returns the known brands, longest first. QUERY_BRANDS is read on
+// the first call rather than in init, so a value from .env is seen.
+func brands() []string {
+	brandsOnce.Do(func() {
+		for _, brand := range strings.Split(os.Getenv("QUERY_BRANDS"), ",") {
+			if brand = strings.TrimSpace(brand); brand != "" && matchBrand(knownBrands, brand) == "" {
+				knownBrands = append(knownBrands, brand)
+			}
+		}
+		// Longer names are matched first so "LG" does not shadow a brand
+		// that starts with it.
+		sort.SliceStable(knownBrands, func(i, j int) bool {
+			return len(knownBrands[i]) > len(knownBrands[j])
+		})
+	})
+	return knownBrands
+}
+
+// canonicalBrand returns the known spelling of brand, or "" if it is unknown.
+func canonicalBrand(brand string) string {
+	return matchBrand(brands(), brand)
+}
+
+func matchBrand(known []string, brand string) string {
+	for _, k := range known {
+		if strings.EqualFold(k, brand) {
+			return k
+		}
+	}
+	return ""
+}
+
+// brandFromName infers a product's brand from the start of its name, either
+// the brand itself ("Dell XPS 13") or a product line ("iPhone 15 Pro").
+func brandFromName(name string) string {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return ""
+	}
+	for _, brand := range brands() {
+		n := len(strings.Fields(brand))
+		if n <= len(words) && strings.EqualFold(strings.Join(words[:n], " "), brand) {
+			return brand
+		}
+	}
+	return productLines[strings.ToLower(words[0])]
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Categorizer assigns a product to one of productCategories.
+type Categorizer interface {
+	Categorize(ctx context.Context, p Product) (Categorization, error)
+}
+
+// Categorization is a categorizer's decision.
+type Categorization struct {
+	Category string `json:"category"`
+	// Confidence is between 0 and 1.
+	Confidence float64 `json:"confidence"`
+	// Source names the categorizer that decided, e.g. "keyword" or "llm".
+	Source string `json:"source"`
+}
+
+// defaultCategory is used when no categorizer can place a product.
+const defaultCategory = "electronics"
+
+// categorizer is configured by CATEGORIZER at startup.
+var categorizer Categorizer = keywordRules
+
+// categorizeProduct picks a category for a product the caller did not
+// categorize. It always returns a category.
+func categorizeProduct(ctx context.Context, p Product) Categorization {
+	result, err := categorizer.Categorize(ctx, p)
+	if err != nil {
+		log.Printf("Error categorizing %q: %v", p.Name, err)
+		return Categorization{Category: defaultCategory, Source: "default"}
+	}
+	return result
+}
+
+// initCategorizer builds the categorizer from CATEGORIZER, a comma-separated
+// chain such as "keyword:0.5,llm". Each step's result is accepted when its
+// confidence reaches the step's threshold; otherwise the next step runs.
+func initCategorizer() {
+	keywordRules = loadKeywordRules()
+
+	spec := getEnv("CATEGORIZER", "keyword")
+	c, err := newCategorizer(spec)
+	if err != nil {
+		log.Printf("Invalid CATEGORIZER %q, using keyword: %v", spec, err)
+		c, spec = keywordRules, "keyword"
+	}
+	log.Printf("Using %s categorizer", spec)
+	categorizer = c
+}
+
+// loadKeywordRules reads CATEGORY_RULES_FILE, falling back to the built-in
+// rules. Those were written for the built-in taxonomy, so with a custom one
+// they may not load either, and keyword categorization is off.
+func loadKeywordRules() *keywordCategorizer {
+	if path := os.Getenv("CATEGORY_RULES_FILE"); path != "" {
+		rules, err := loadCategoryRules(path)
+		if err == nil {
+			return rules
+		}
+		log.Printf("Error loading category rules, using the built-in rules: %v", err)
+	}
+	rules, err := parseCategoryRules(defaultCategoryRules)
+	if err != nil {
+		log.Printf("Built-in category rules do not fit the taxonomy, keyword categorization is off: %v", err)
+		return &keywordCategorizer{}
+	}
+	return rules
+}
+
+func newCategorizer(spec string) (Categorizer, error) {
+	var chain chainCategorizer
+	for _, step := range strings.Split(spec, ",") {
+		name, threshold, hasThreshold := strings.Cut(strings.TrimSpace(step), ":")
+		minConfidence := 0.0
+		if hasThreshold {
+			parsed, err := strconv.ParseFloat(threshold, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				return nil, fmt.Errorf("confidence threshold %q must be between 0 and 1", threshold)
+			}
+			minConfidence = parsed
+		}
+
+		var c Categorizer
+		switch name {
+		case "keyword":
+			c = keywordRules
+		case "llm":
+			c = llmCategorizer{}
+		case "knn":
+			k := getEnvInt("CATEGORIZER_KNN_K", 5)
+			if k < 1 {
+				return nil, errors.New("CATEGORIZER_KNN_K must be at least 1")
+			}
+			maxDistance, err := strconv.ParseFloat(getEnv("CATEGORIZER_KNN_MAX_DISTANCE", "0.8"), 64)
+			if err != nil || maxDistance <= 0 || maxDistance > 2 {
+				return nil, errors.New("CATEGORIZER_KNN_MAX_DISTANCE must be between 0 and 2")
+			}
+			c = knnCategorizer{k: k, maxDistance: maxDistance}
+		default:
+			return nil, fmt.Errorf("unknown categorizer %q", name)
+		}
+		chain.steps = append(chain.steps, chainStep{categorizer: c, minConfidence: minConfidence})
+	}
+
+	// kNN needs something to defer to, and the LLM can fail on a missing
+	// key or an outage, so a chain never ends with either: the keyword rules
+	// answer when they cannot.
+	switch chain.steps[len(chain.steps)-1].categorizer.(type) {
+	case knnCategorizer, llmCategorizer:
+		chain.steps = append(chain.steps, chainStep{categorizer: keywordRules})
+	}
+
+	if len(chain.steps) == 1 {
+		return chain.steps[0].categorizer, nil
+	}
+	return chain, nil
+}
+
+type chainStep struct {
+	categorizer   Categorizer
+	minConfidence float64
+}
+
+// chainCategorizer tries its steps in order and returns the first confident
+// result. When none is confident enough, the most confident one wins.
+type chainCategorizer struct {
+	steps []chainStep
+}
+
+func (c chainCategorizer) Categorize(ctx context.Context, p Product) (Categorization, error) {
+	var best *Categorization
+	var lastErr error
+	for i, step := range c.steps {
+		result, err := step.categorizer.Categorize(ctx, p)
+		if err != nil {
+			if !errors.Is(err, errKNNDeferred) {
+				log.Printf("Categorizer step %d failed for %q: %v", i+1, p.Name, err)
+			}
+			lastErr = err
+			continue
+		}
+		if result.Confidence >= step.minConfidence {
+			return result, nil
+		}
+		if best == nil || result.Confidence > best.Confidence {
+			best = &result
+		}
+	}
+	if best != nil {
+		return *best, nil
+	}
+	return Categorization{}, lastErr
+}
+
+// llmCategorizer asks the chat model configured by LLM_MODEL.
+type llmCategorizer struct{}
+
+func (llmCategorizer) Categorize(ctx context.Context, p Product) (Categorization, error) {
+	paths := make([]string, len(productCategories))
+	for i, category := range productCategories {
+		paths[i] = "- " + strings.Join(taxonomy.path(category), " > ")
+	}
+	prompt := fmt.Sprintf(`Categorize this product into this category tree:
+%s
+
+Product: %s
+Description: %s
+
+Choose the most specific category that fits. Return only a JSON object like {"category": "headphones", "confidence": 0.9}, using the last name of the path, where confidence between 0 and 1 says how sure you are.`,
+		strings.Join(paths, "\n"), p.Name, p.Description)
+
+	reply, err := chatCompletion(ctx, prompt, 50)
+	if err != nil {
+		return Categorization{}, err
+	}
+
+	reply = stripCodeFence(reply)
+	var answer struct {
+		Category   string  `json:"category"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := json.Unmarshal([]byte(reply), &answer); err != nil {
+		// A bare category name is a usable answer with unknown confidence.
+		answer.Category, answer.Confidence = reply, 0.5
+	}
+
+	category := strings.ToLower(strings.TrimSpace(answer.Category))
+	if !containsString(productCategories, category) {
+		return Categorization{}, fmt.Errorf("model returned unknown category %q", answer.Category)
+	}
+	return Categorization{Category: category, Confidence: math.Max(0, math.Min(1, answer.Confidence)), Source: "llm"}, nil
+}
+
+// knnCategorizer labels a product by majority vote of its k nearest
+// categorized neighbours, like Weaviate's kNN classification, rolling votes
+// up the taxonomy when the neighbours disagree on a leaf. Neighbours
+// further than maxDistance do not vote. Without a majority it defers, by
+// returning errKNNDeferred, to the next categorizer in the chain.
+type knnCategorizer struct {
+	k           int
+	maxDistance float64
+}
+
+var errKNNDeferred = errors.New("knn deferred")
+
+func (c knnCategorizer) Categorize(ctx context.Context, p Product) (Categorization, error) {
+	// One extra result in case the product itself is already indexed.
+	neighbours, err := store.NearText(ctx, productText(p), SearchOptions{Limit: c.k + 1, MaxDistance: &c.maxDistance})
+	if err != nil {
+		return Categorization{}, err
+	}
+
+	// Each neighbour votes for its category and all of its ancestors, so
+	// neighbours that split between "headphones" and "earbuds" still agree
+	// on "audio".
+	votes := map[string]int{}
+	counted := 0
+	for _, neighbour := range neighbours {
+		if counted == c.k {
+			break
+		}
+		if p.ID != "" && neighbour.ID == p.ID {
+			continue
+		}
+		// Only categories the other categorizers could also pick count.
+		if !containsString(productCategories, neighbour.Category) {
+			continue
+		}
+		for _, category := range taxonomy.path(neighbour.Category) {
+			votes[category]++
+		}
+		counted++
+	}
+	if counted == 0 {
+		return Categorization{}, fmt.Errorf("%w: no categorized neighbours within distance %g", errKNNDeferred, c.maxDistance)
+	}
+
+	// The most specific category with a majority wins. Only one category
+	// per level of the tree can have a majority, so the choice is unique.
+	winner := ""
+	for category, n := range votes {
+		if n*2 > counted && (winner == "" || len(taxonomy.path(category)) > len(taxonomy.path(winner))) {
+			winner = category
+		}
+	}
+	if winner == "" {
+		return Categorization{}, fmt.Errorf("%w: no majority among %d neighbours", errKNNDeferred, counted)
+	}
+
+	// Confidence is the winner's share of all k votes, so a majority of
+	// only a few close neighbours is less certain than a full one.
+	return Categorization{Category: winner, Confidence: float64(votes[winner]) / float64(c.k), Source: "knn"}, nil
+}
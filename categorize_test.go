@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubCategorizer returns a fixed result or error.
+type stubCategorizer struct {
+	result Categorization
+	err    error
+}
+
+func (s stubCategorizer) Categorize(ctx context.Context, p Product) (Categorization, error) {
+	return s.result, s.err
+}
+
+func TestKeywordCategorizer(t *testing.T) {
+	tests := []struct {
+		name        string
+		productName string
+		description string
+		want        Categorization
+	}{
+		{"leaf from the name", "Sony WH-1000XM5 Headphones", "Wireless and over ear", Categorization{Category: "headphones", Confidence: 1, Source: "keyword"}},
+		{"product line", "AirPods Pro", "Apple earbuds with a charging case", Categorization{Category: "earbuds", Confidence: 0.92, Source: "keyword"}},
+		{"longer keyword outweighs a shorter one", "Kindle Fire HD", "A tablet for the family", Categorization{Category: "tablets", Confidence: 0.63, Source: "keyword"}},
+		{"ancestors do not compete", "Audio headphones", "", Categorization{Category: "headphones", Confidence: 1, Source: "keyword"}},
+		{"weak match is less confident", "Bike", "", Categorization{Category: "fitness", Confidence: 0.5, Source: "keyword"}},
+		{"description only", "Model Y", "An electric vehicle with autopilot", Categorization{Category: "automotive", Confidence: 1, Source: "keyword"}},
+		{"no match", "Ceramic mug", "Holds coffee", Categorization{Category: defaultCategory, Confidence: 0, Source: "keyword"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keywordRules.Categorize(context.Background(), Product{Name: tt.productName, Description: tt.description})
+			if err != nil {
+				t.Fatalf("Categorize: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCategoryRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{"valid", "name_weight: 2\ndescription_weight: 1\nconfident_score: 3\nrules:\n  - category: audio\n    keywords: [speaker^2, audio]\n", ""},
+		{"json", `{"name_weight": 1, "description_weight": 0, "confident_score": 1, "rules": [{"category": "laptops", "keywords": ["laptop"]}]}`, ""},
+		{"unknown key", "name_wieght: 2\ndescription_weight: 1\nconfident_score: 3\nrules: []\n", "field name_wieght not found"},
+		{"no weights", "name_weight: 0\ndescription_weight: 0\nconfident_score: 3\nrules: [{category: audio, keywords: [speaker]}]\n", "must not be negative"},
+		{"no rules", "name_weight: 1\ndescription_weight: 1\nconfident_score: 3\n", "no rules"},
+		{"unknown category", "name_weight: 1\ndescription_weight: 1\nconfident_score: 3\nrules: [{category: toys, keywords: [lego]}]\n", `unknown category "toys"`},
+		{"duplicate category", "name_weight: 1\ndescription_weight: 1\nconfident_score: 3\nrules: [{category: audio, keywords: [speaker]}, {category: audio, keywords: [radio]}]\n", "already has a rule"},
+		{"bad weight", "name_weight: 1\ndescription_weight: 1\nconfident_score: 3\nrules: [{category: audio, keywords: [speaker^0]}]\n", "invalid weight"},
+		{"no keywords", "name_weight: 1\ndescription_weight: 1\nconfident_score: 3\nrules: [{category: audio, keywords: []}]\n", "has no keywords"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCategoryRules([]byte(tt.rules))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("parseCategoryRules: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKNNCategorizer(t *testing.T) {
+	neighbours := func(categories ...string) []Product {
+		products := make([]Product, len(categories))
+		for i, category := range categories {
+			products[i] = Product{Name: "Wireless device " + string(rune('A'+i)), Description: "Wireless device", Category: category}
+		}
+		return products
+	}
+	product := Product{Name: "Wireless device", Description: "Wireless device"}
+
+	tests := []struct {
+		name        string
+		indexed     []Product
+		maxDistance float64
+		want        Categorization
+		// deferred means the categorizer passes to the next in the chain.
+		deferred bool
+	}{
+		{"unanimous", neighbours("headphones", "headphones", "headphones"), 2, Categorization{Category: "headphones", Confidence: 1, Source: "knn"}, false},
+		{"leaf majority", neighbours("headphones", "earbuds", "earbuds"), 2, Categorization{Category: "earbuds", Confidence: 2.0 / 3, Source: "knn"}, false},
+		{"votes roll up the taxonomy", neighbours("headphones", "earbuds", "speakers"), 2, Categorization{Category: "audio", Confidence: 1, Source: "knn"}, false},
+		{"root majority", neighbours("headphones", "laptops", "tablets"), 2, Categorization{Category: "electronics", Confidence: 1, Source: "knn"}, false},
+		{"fewer than k neighbours", neighbours("cameras"), 2, Categorization{Category: "cameras", Confidence: 1.0 / 3, Source: "knn"}, false},
+		{"unknown categories do not vote", neighbours("vacuums", "misc", "misc"), 2, Categorization{Category: "vacuums", Confidence: 1.0 / 3, Source: "knn"}, false},
+		{"no majority", neighbours("headphones", "vacuums", "automotive"), 2, Categorization{}, true},
+		{"no neighbours", nil, 2, Categorization{}, true},
+		{"neighbours too far", neighbours("headphones", "headphones", "headphones"), 0.01, Categorization{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMemoryStore(t, tt.indexed...)
+			got, err := knnCategorizer{k: 3, maxDistance: tt.maxDistance}.Categorize(context.Background(), product)
+			if tt.deferred {
+				if !errors.Is(err, errKNNDeferred) {
+					t.Fatalf("got %+v, %v, want errKNNDeferred", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Categorize: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKNNCategorizerSkipsItself(t *testing.T) {
+	self := Product{Name: "Wireless device", Description: "Wireless device", Category: "speakers"}
+	self.ID = productID(self)
+	useMemoryStore(t, self,
+		Product{Name: "Wireless device A", Description: "Wireless device", Category: "headphones"},
+		Product{Name: "Wireless device B", Description: "Wireless device", Category: "headphones"},
+	)
+
+	got, err := knnCategorizer{k: 2, maxDistance: 2}.Categorize(context.Background(), self)
+	if err != nil {
+		t.Fatalf("Categorize: %v", err)
+	}
+	want := Categorization{Category: "headphones", Confidence: 1, Source: "knn"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestChainCategorizer(t *testing.T) {
+	unsure := stubCategorizer{result: Categorization{Category: "audio", Confidence: 0.4, Source: "first"}}
+	lessSure := stubCategorizer{result: Categorization{Category: "cameras", Confidence: 0.3, Source: "second"}}
+	sure := stubCategorizer{result: Categorization{Category: "laptops", Confidence: 0.9, Source: "second"}}
+	failing := stubCategorizer{err: errors.New("model unavailable")}
+
+	tests := []struct {
+		name    string
+		steps   []chainStep
+		want    Categorization
+		wantErr bool
+	}{
+		{"first confident step wins", []chainStep{{unsure, 0.3}, {sure, 0}}, unsure.result, false},
+		{"unsure step passes on", []chainStep{{unsure, 0.5}, {sure, 0.5}}, sure.result, false},
+		{"most confident when none is sure", []chainStep{{unsure, 0.5}, {lessSure, 0.5}}, unsure.result, false},
+		{"failed step passes on", []chainStep{{failing, 0}, {unsure, 0}}, unsure.result, false},
+		{"all steps failed", []chainStep{{failing, 0}, {failing, 0}}, Categorization{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := chainCategorizer{steps: tt.steps}.Categorize(context.Background(), Product{Name: "Thing"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategorizerChain(t *testing.T) {
+	useMemoryStore(t)
+	t.Setenv("OPENAI_API_KEY", "")
+	product := Product{Name: "Dell XPS 13 Laptop", Description: "Compact laptop"}
+
+	tests := []struct {
+		spec       string
+		wantSource string
+	}{
+		{"keyword", "keyword"},
+		// With nothing indexed kNN defers, and a chain ending in kNN
+		// falls back to the keyword rules.
+		{"knn", "keyword"},
+		{"keyword:0.5,knn", "keyword"},
+		// The LLM fails without an API key, and so does a chain ending in
+		// it fall back to the keyword rules.
+		{"llm", "keyword"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := newCategorizer(tt.spec)
+			if err != nil {
+				t.Fatalf("newCategorizer: %v", err)
+			}
+			got, err := c.Categorize(context.Background(), product)
+			if err != nil {
+				t.Fatalf("Categorize: %v", err)
+			}
+			if got.Category != "laptops" || got.Source != tt.wantSource {
+				t.Errorf("got %+v, want laptops from %s", got, tt.wantSource)
+			}
+		})
+	}
+
+	for _, spec := range []string{"keyword:2", "knn:x", "magic", ""} {
+		if _, err := newCategorizer(spec); err == nil {
+			t.Errorf("newCategorizer(%q) succeeded, want an error", spec)
+		}
+	}
+}
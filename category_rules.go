@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed category_rules.yaml
+var defaultCategoryRules []byte
+
+// CategoryRules is the rule file read by the keyword categorizer. JSON files
+// work too, since JSON is valid YAML.
+type CategoryRules struct {
+	NameWeight        float64        `yaml:"name_weight"`
+	DescriptionWeight float64        `yaml:"description_weight"`
+	ConfidentScore    float64        `yaml:"confident_score"`
+	Rules             []CategoryRule `yaml:"rules"`
+}
+
+// CategoryRule lists the keywords of one category. Keywords may carry a
+// weight as "keyword^2".
+type CategoryRule struct {
+	Category string   `yaml:"category"`
+	Keywords []string `yaml:"keywords"`
+}
+
+type weightedKeyword struct {
+	// term is normalized with normalizeWords.
+	term   string
+	weight float64
+}
+
+type keywordRule struct {
+	category string
+	keywords []weightedKeyword
+}
+
+// keywordCategorizer scores every rule against the product's name and
+// description and picks the best one. Rules are ordered, so the result does
+// not depend on anything but the rules and the product.
+type keywordCategorizer struct {
+	nameWeight        float64
+	descriptionWeight float64
+	confidentScore    float64
+	rules             []keywordRule
+}
+
+// keywordRules is the rule set used by the "keyword" categorizer.
+var keywordRules = mustParseCategoryRules(defaultCategoryRules)
+
+func mustParseCategoryRules(data []byte) *keywordCategorizer {
+	c, err := parseCategoryRules(data)
+	if err != nil {
+		panic(fmt.Sprintf("built-in category rules: %v", err))
+	}
+	return c
+}
+
+// loadCategoryRules reads the rule file at path.
+func loadCategoryRules(path string) (*keywordCategorizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := parseCategoryRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func parseCategoryRules(data []byte) (*keywordCategorizer, error) {
+	var file CategoryRules
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// Misspelled keys would otherwise silently fall back to zero values.
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	if file.NameWeight < 0 || file.DescriptionWeight < 0 || file.NameWeight+file.DescriptionWeight == 0 {
+		return nil, errors.New("name_weight and description_weight must not be negative, and one must be positive")
+	}
+	if file.ConfidentScore <= 0 {
+		return nil, errors.New("confident_score must be positive")
+	}
+	if len(file.Rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+
+	c := &keywordCategorizer{
+		nameWeight:        file.NameWeight,
+		descriptionWeight: file.DescriptionWeight,
+		confidentScore:    file.ConfidentScore,
+	}
+	seen := map[string]bool{}
+	for i, rule := range file.Rules {
+		if !containsString(productCategories, rule.Category) {
+			return nil, fmt.Errorf("rule %d: unknown category %q", i+1, rule.Category)
+		}
+		if seen[rule.Category] {
+			return nil, fmt.Errorf("rule %d: category %q already has a rule", i+1, rule.Category)
+		}
+		seen[rule.Category] = true
+
+		compiled := keywordRule{category: rule.Category}
+		for _, keyword := range rule.Keywords {
+			term, weight := keyword, 1.0
+			if base, w, ok := strings.Cut(keyword, "^"); ok {
+				parsed, err := strconv.ParseFloat(w, 64)
+				if err != nil || parsed <= 0 {
+					return nil, fmt.Errorf("rule %d: keyword %q has an invalid weight", i+1, keyword)
+				}
+				term, weight = base, parsed
+			}
+			term = normalizeWords(term)
+			if term == "" {
+				return nil, fmt.Errorf("rule %d: empty keyword", i+1)
+			}
+			compiled.keywords = append(compiled.keywords, weightedKeyword{term: term, weight: weight})
+		}
+		if len(compiled.keywords) == 0 {
+			return nil, fmt.Errorf("rule %d: category %q has no keywords", i+1, rule.Category)
+		}
+		c.rules = append(c.rules, compiled)
+	}
+	return c, nil
+}
+
+// normalizeWords lower-cases s and reduces it to space-separated words of
+// letters and digits, so "E-Reader" and "e reader" compare equal.
+func normalizeWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), " ")
+}
+
+// containsWords reports whether the normalized text contains term as whole
+// words, optionally followed by a plural "s".
+func containsWords(text, term string) bool {
+	return strings.Contains(text, " "+term+" ") || strings.Contains(text, " "+term+"s ")
+}
+
+func (c *keywordCategorizer) Categorize(ctx context.Context, p Product) (Categorization, error) {
+	name := " " + normalizeWords(p.Name) + " "
+	description := " " + normalizeWords(p.Description) + " "
+
+	best, bestScore := "", 0.0
+	scores := make([]float64, len(c.rules))
+	for i, rule := range c.rules {
+		score := 0.0
+		for _, keyword := range rule.keywords {
+			if containsWords(name, keyword.term) {
+				score += keyword.weight * c.nameWeight
+			}
+			if containsWords(description, keyword.term) {
+				score += keyword.weight * c.descriptionWeight
+			}
+		}
+		scores[i] = score
+		// Strictly greater, so ties go to the earlier rule.
+		if score > bestScore {
+			best, bestScore = rule.category, score
+		}
+	}
+	if best == "" {
+		return Categorization{Category: defaultCategory, Confidence: 0, Source: "keyword"}, nil
+	}
+
+	// Matches on the winner's own branch of the taxonomy agree with it.
+	total := bestScore
+	for i, rule := range c.rules {
+		if !taxonomy.related(rule.category, best) {
+			total += scores[i]
+		}
+	}
+
+	// Confidence is the winner's share of all matches, scaled down when even
+	// the winner matched only weakly.
+	confidence := bestScore / total * math.Min(1, bestScore/c.confidentScore)
+	return Categorization{Category: best, Confidence: math.Round(confidence*100) / 100, Source: "keyword"}, nil
+}
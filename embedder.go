@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns text into vectors. The service embeds everything itself and
+// stores the vectors in a class with no server-side vectorizer, so the same
+// code path works against OpenAI, a self-hosted model or fully offline.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderConfig selects and configures an embedder. API keys are not part
+// of it; they always come from the environment.
+type EmbedderConfig struct {
+	// Kind is "openai", "openai-compatible" or "local".
+	Kind       string `json:"kind"`
+	Model      string `json:"model,omitempty"`
+	BaseURL    string `json:"base_url,omitempty"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+// embedderConfigFromEnv reads EMBEDDER and friends. Without an explicit
+// choice it uses OpenAI when a key is configured and the offline embedder
+// otherwise.
+func embedderConfigFromEnv() EmbedderConfig {
+	kind := os.Getenv("EMBEDDER")
+	if kind == "" {
+		kind = "openai"
+		if os.Getenv("OPENAI_API_KEY") == "" {
+			kind = "local"
+		}
+	}
+
+	return EmbedderConfig{
+		Kind:       kind,
+		Model:      os.Getenv("EMBEDDING_MODEL"),
+		BaseURL:    os.Getenv("EMBEDDING_BASE_URL"),
+		Dimensions: getEnvInt("EMBEDDING_DIMENSIONS", 0),
+	}.withDefaults()
+}
+
+// withDefaults fills in the defaults for the kind and drops settings the kind
+// does not use, so equal configs produce the same vectors.
+func (c EmbedderConfig) withDefaults() EmbedderConfig {
+	switch c.Kind {
+	case "openai":
+		return EmbedderConfig{Kind: c.Kind, Model: valueOr(c.Model, "text-embedding-3-small")}
+	case "openai-compatible":
+		return EmbedderConfig{
+			Kind:    c.Kind,
+			Model:   valueOr(c.Model, "nomic-embed-text"),
+			BaseURL: strings.TrimRight(valueOr(c.BaseURL, "http://localhost:11434/v1"), "/"),
+		}
+	case "local":
+		if c.Dimensions <= 0 {
+			c.Dimensions = 384
+		}
+		return EmbedderConfig{Kind: c.Kind, Dimensions: c.Dimensions}
+	default:
+		log.Printf("Unknown EMBEDDER %q, falling back to local embeddings", c.Kind)
+		return EmbedderConfig{Kind: "local"}.withDefaults()
+	}
+}
+
+func (c EmbedderConfig) String() string {
+	switch c.Kind {
+	case "local":
+		return fmt.Sprintf("local (%d dimensions)", c.Dimensions)
+	case "openai-compatible":
+		return fmt.Sprintf("openai-compatible %s at %s", c.Model, c.BaseURL)
+	}
+	return c.Kind + " " + c.Model
+}
+
+// newEmbedder builds the embedder configured in the environment.
+func newEmbedder() Embedder {
+	return newEmbedderFromConfig(embedderConfigFromEnv())
+}
+
+func newEmbedderFromConfig(cfg EmbedderConfig) Embedder {
+	cfg = cfg.withDefaults()
+	log.Printf("Using %s embeddings", cfg)
+
+	switch cfg.Kind {
+	case "openai":
+		return &openAIEmbedder{
+			baseURL: "https://api.openai.com/v1",
+			apiKey:  os.Getenv("OPENAI_API_KEY"),
+			model:   cfg.Model,
+			client:  &http.Client{Timeout: 30 * time.Second},
+		}
+	case "openai-compatible":
+		return &openAIEmbedder{
+			baseURL: cfg.BaseURL,
+			apiKey:  os.Getenv("EMBEDDING_API_KEY"),
+			model:   cfg.Model,
+			client:  &http.Client{Timeout: 60 * time.Second},
+		}
+	default:
+		return newLocalEmbedder(cfg.Dimensions)
+	}
+}
+
+func valueOr(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// embedOne is a convenience for the common single-query case.
+func embedOne(ctx context.Context, e Embedder, text string) ([]float32, error) {
+	vectors, err := e.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 input", len(vectors))
+	}
+	return vectors[0], nil
+}
+
+// OpenAI embeddings API structures
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingResponse struct {
+	Data []EmbeddingData `json:"data"`
+}
+
+type EmbeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// openAIEmbedder talks to the OpenAI embeddings endpoint or anything that
+// speaks the same protocol (Ollama, vLLM, LocalAI).
+type openAIEmbedder struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// openAIBatchSize keeps requests well under the provider's input limits.
+const openAIBatchSize = 100
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIBatchSize {
+		end := start + openAIBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *openAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	jsonData, err := json.Marshal(EmbeddingRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling embedding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/embeddings", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("creating embedding request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling embeddings API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &embedderStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+	}
+
+	var embeddingResp EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
+		return nil, fmt.Errorf("decoding embedding response: %w", err)
+	}
+
+	if len(embeddingResp.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings API returned %d vectors for %d inputs", len(embeddingResp.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range embeddingResp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings API returned out of range index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// embedderStatusError is an embeddings API response other than 200 OK. The
+// status lets callers tell rate limiting and server errors from bad requests.
+type embedderStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *embedderStatusError) Error() string {
+	return fmt.Sprintf("embeddings API returned %s: %s", e.Status, e.Body)
+}
+
+// localEmbedder projects word unigrams, word bigrams and character trigrams
+// into a fixed number of dimensions with the hashing trick. It has no notion
+// of synonyms, but it is deterministic and works with no network at all.
+type localEmbedder struct {
+	dimensions int
+}
+
+func newLocalEmbedder(dimensions int) *localEmbedder {
+	if dimensions <= 0 {
+		dimensions = 384
+	}
+	return &localEmbedder{dimensions: dimensions}
+}
+
+func (e *localEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *localEmbedder) embed(text string) []float32 {
+	counts := map[string]float64{}
+	words := tokenize(text)
+
+	for i, word := range words {
+		counts["w:"+word] += 1.0
+		if i > 0 {
+			counts["b:"+words[i-1]+" "+word] += 0.5
+		}
+		padded := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			counts["c:"+string(padded[j:j+3])] += 0.25
+		}
+	}
+
+	vector := make([]float64, e.dimensions)
+	for feature, tf := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		index := int(sum % uint64(e.dimensions))
+		// The top bit decides the sign so colliding features tend to cancel
+		// rather than pile up.
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1.0
+		}
+		vector[index] += sign * (1 + math.Log(1+tf))
+	}
+
+	return normalize(vector)
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func normalize(vector []float64) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	out := make([]float32, len(vector))
+	if norm == 0 {
+		return out
+	}
+	for i, v := range vector {
+		out[i] = float32(v / norm)
+	}
+	return out
+}
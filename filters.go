@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SearchFilters narrows a search to matching products before ranking, so
+// the limit applies to the filtered set.
+type SearchFilters struct {
+	Category   string           `json:"category"`
+	Categories []string         `json:"categories"`
+	Properties []PropertyFilter `json:"properties"`
+}
+
+// PropertyFilter is a generic condition on a single product property.
+//
+// Supported operators are "equals", "not_equals", "contains" (substring for
+// text, membership for arrays) and "range" (inclusive min and/or max).
+type PropertyFilter struct {
+	Property string      `json:"property"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value,omitempty"`
+	Min      *float64    `json:"min,omitempty"`
+	Max      *float64    `json:"max,omitempty"`
+}
+
+// propertyTypes lists the product properties that can be filtered on and
+// their Weaviate data types.
+var propertyTypes = map[string]string{
+	"sku":           "text",
+	"name":          "text",
+	"description":   "text",
+	"category":      "text",
+	"category_path": "text[]",
+	"brand":         "text",
+	"price":         "number",
+	"currency":      "text",
+	"in_stock":      "boolean",
+	"tags":          "text[]",
+}
+
+func (f *SearchFilters) isEmpty() bool {
+	return f == nil || (f.Category == "" && len(f.Categories) == 0 && len(f.Properties) == 0)
+}
+
+func (f *SearchFilters) validate() error {
+	if f == nil {
+		return nil
+	}
+
+	for _, pf := range f.Properties {
+		dataType, ok := propertyTypes[pf.Property]
+		if !ok {
+			return fmt.Errorf("cannot filter on unknown property %q", pf.Property)
+		}
+
+		switch pf.Operator {
+		case "equals", "not_equals", "contains":
+			if pf.Value == nil {
+				return fmt.Errorf("%s filter on %q requires a value", pf.Operator, pf.Property)
+			}
+			if err := checkValueType(pf.Property, dataType, pf.Value); err != nil {
+				return err
+			}
+			if pf.Operator == "contains" && dataType != "text" && dataType != "text[]" {
+				return fmt.Errorf("contains filter is not supported on %s property %q", dataType, pf.Property)
+			}
+		case "range":
+			if dataType != "number" && dataType != "int" {
+				return fmt.Errorf("range filter is not supported on %s property %q", dataType, pf.Property)
+			}
+			if pf.Min == nil && pf.Max == nil {
+				return fmt.Errorf("range filter on %q requires min or max", pf.Property)
+			}
+		default:
+			return fmt.Errorf("unknown filter operator %q", pf.Operator)
+		}
+	}
+	return nil
+}
+
+func checkValueType(property, dataType string, value interface{}) error {
+	var ok bool
+	switch dataType {
+	case "text", "text[]":
+		_, ok = value.(string)
+	case "number", "int":
+		_, ok = value.(float64)
+	case "boolean":
+		_, ok = value.(bool)
+	default:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("filter value for %q must be a %s", property, dataType)
+	}
+	return nil
+}
+
+// matchesFilters evaluates filters against a product's properties. Stores
+// that cannot push filters down to the database use it directly.
+func matchesFilters(props map[string]interface{}, f *SearchFilters) bool {
+	if f.isEmpty() {
+		return true
+	}
+
+	// Category filters match at any level of the taxonomy.
+	path, _ := props["category_path"].([]string)
+	if f.Category != "" && !containsFold(path, f.Category) {
+		return false
+	}
+	if len(f.Categories) > 0 && !containsAnyFold(path, f.Categories) {
+		return false
+	}
+
+	for _, pf := range f.Properties {
+		if !matchesProperty(props[pf.Property], pf) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesProperty(actual interface{}, pf PropertyFilter) bool {
+	switch pf.Operator {
+	case "equals":
+		return valueEquals(actual, pf.Value)
+	case "not_equals":
+		return !valueEquals(actual, pf.Value)
+	case "contains":
+		want, _ := pf.Value.(string)
+		switch v := actual.(type) {
+		case string:
+			return strings.Contains(strings.ToLower(v), strings.ToLower(want))
+		case []string:
+			return containsFold(v, want)
+		}
+		return false
+	case "range":
+		n, ok := toFloat(actual)
+		if !ok {
+			return false
+		}
+		if pf.Min != nil && n < *pf.Min {
+			return false
+		}
+		if pf.Max != nil && n > *pf.Max {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+func valueEquals(actual, want interface{}) bool {
+	switch v := actual.(type) {
+	case string:
+		s, ok := want.(string)
+		return ok && strings.EqualFold(v, s)
+	case []string:
+		s, ok := want.(string)
+		return ok && containsFold(v, s)
+	case bool:
+		b, ok := want.(bool)
+		return ok && v == b
+	}
+	if n, ok := toFloat(actual); ok {
+		w, ok := toFloat(want)
+		return ok && n == w
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func containsAnyFold(values, wants []string) bool {
+	for _, want := range wants {
+		if containsFold(values, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, want string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestSearchFiltersValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters *SearchFilters
+		wantErr string
+	}{
+		{"nil", nil, ""},
+		{"valid", &SearchFilters{Category: "laptops", Properties: []PropertyFilter{{Property: "name", Operator: "contains", Value: "xps"}}}, ""},
+		{"unknown property", &SearchFilters{Properties: []PropertyFilter{{Property: "colour", Operator: "equals", Value: "red"}}}, `cannot filter on unknown property "colour"`},
+		{"unknown operator", &SearchFilters{Properties: []PropertyFilter{{Property: "name", Operator: "like", Value: "x"}}}, `unknown filter operator "like"`},
+		{"missing value", &SearchFilters{Properties: []PropertyFilter{{Property: "name", Operator: "equals"}}}, `equals filter on "name" requires a value`},
+		{"wrong value type", &SearchFilters{Properties: []PropertyFilter{{Property: "sku", Operator: "equals", Value: 5.0}}}, `filter value for "sku" must be a text`},
+		{"range on price", &SearchFilters{Properties: []PropertyFilter{{Property: "price", Operator: "range", Min: float64Ptr(10)}}}, ""},
+		{"range without bounds", &SearchFilters{Properties: []PropertyFilter{{Property: "price", Operator: "range"}}}, `range filter on "price" requires min or max`},
+		{"boolean as text", &SearchFilters{Properties: []PropertyFilter{{Property: "in_stock", Operator: "equals", Value: "yes"}}}, `filter value for "in_stock" must be a boolean`},
+		{"contains on boolean", &SearchFilters{Properties: []PropertyFilter{{Property: "in_stock", Operator: "contains", Value: true}}}, `contains filter is not supported on boolean property "in_stock"`},
+		{"range on text", &SearchFilters{Properties: []PropertyFilter{{Property: "name", Operator: "range"}}}, `range filter is not supported on text property "name"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filters.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// productNamespace scopes the UUIDv5 product IDs to this service so they never
+// collide with IDs generated elsewhere. Changing it re-keys every product.
+var productNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("vector-search/product"))
+
+// productID derives a stable ID from the product's SKU, or from its name when
+// there is no SKU. The same product always maps to the same Weaviate object,
+// so re-ingesting a catalog updates objects instead of duplicating them.
+func productID(p Product) string {
+	key := "name:" + normalizeKey(p.Name)
+	if sku := normalizeKey(p.SKU); sku != "" {
+		key = "sku:" + sku
+	}
+	return uuid.NewSHA1(productNamespace, []byte(key)).String()
+}
+
+func normalizeKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Catalog formats understood by parseCatalog.
+const (
+	formatText  = "text"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+)
+
+// ParseError reports a record that could not be turned into a product.
+// Record is the 1-based record number; Line is the source line when known.
+type ParseError struct {
+	Record  int    `json:"record"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"error"`
+}
+
+func (e ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("record %d: %s", e.Record, e.Message)
+}
+
+// ParseResult holds everything parsed from one catalog, good and bad.
+type ParseResult struct {
+	Products []Product
+	Errors   []ParseError
+}
+
+// ColumnMapping maps product fields (id, sku, name, description, category,
+// brand, price, ...) to CSV column headers. Fields without an entry use a column of the same
+// name; any other column becomes an attribute.
+type ColumnMapping map[string]string
+
+// productFieldNames are the record keys that map onto Product fields rather
+// than attributes.
+var productFieldNames = []string{
+	"id", "sku", "name", "description", "category", "brand", "price", "currency",
+	"in_stock", "url", "image_url", "tags", "created_at", "updated_at",
+}
+
+func isCatalogFormat(format string) bool {
+	switch format {
+	case formatText, formatCSV, formatJSON, formatJSONL:
+		return true
+	}
+	return false
+}
+
+// detectFormat guesses the catalog format from a file name.
+func detectFormat(filename string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt":
+		return formatText, nil
+	case ".csv":
+		return formatCSV, nil
+	case ".json":
+		return formatJSON, nil
+	case ".jsonl", ".ndjson":
+		return formatJSONL, nil
+	}
+	return "", fmt.Errorf("cannot detect catalog format of %q", filename)
+}
+
+// parseColumnMapping reads a mapping such as "name=Title,description=Body".
+func parseColumnMapping(s string) (ColumnMapping, error) {
+	mapping := ColumnMapping{}
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		if !ok || !containsString(productFieldNames, field) {
+			return nil, fmt.Errorf("invalid column mapping %q", pair)
+		}
+		mapping[field] = strings.TrimSpace(column)
+	}
+	return mapping, nil
+}
+
+// parseCatalog parses a whole catalog. Records that fail are reported in the
+// result instead of being dropped; only unreadable input returns an error.
+func parseCatalog(r io.Reader, format string, mapping ColumnMapping) (ParseResult, error) {
+	switch format {
+	case formatText:
+		return parseText(r)
+	case formatCSV:
+		return parseCSV(r, mapping)
+	case formatJSON:
+		return parseJSON(r)
+	case formatJSONL:
+		return parseJSONL(r)
+	}
+	return ParseResult{}, fmt.Errorf("unknown catalog format %q", format)
+}
+
+// parseText reads the original documents.txt format: one "Name - Description"
+// product per line.
+func parseText(r io.Reader) (ParseResult, error) {
+	var result ParseResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber, record := 0, 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record++
+
+		name, description, ok := strings.Cut(line, " - ")
+		if !ok {
+			result.Errors = append(result.Errors, ParseError{Record: record, Line: lineNumber, Message: `expected "Name - Description"`})
+			continue
+		}
+
+		product, err := productFromRecord(map[string]interface{}{
+			"name":        name,
+			"description": description,
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, ParseError{Record: record, Line: lineNumber, Message: err.Error()})
+			continue
+		}
+		result.Products = append(result.Products, product)
+	}
+	return result, scanner.Err()
+}
+
+func parseCSV(r io.Reader, mapping ColumnMapping) (ParseResult, error) {
+	var result ParseResult
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		return result, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	// Resolve each column to a product field, or to an attribute name.
+	columnField := make([]string, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+		columnField[i] = "attr:" + column
+		for _, field := range productFieldNames {
+			mapped, ok := mapping[field]
+			if !ok {
+				mapped = field
+			}
+			if strings.EqualFold(column, mapped) {
+				columnField[i] = field
+				break
+			}
+		}
+	}
+
+	for record := 1; ; record++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.Errors = append(result.Errors, ParseError{Record: record, Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("reading CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) > len(header) {
+			result.Errors = append(result.Errors, ParseError{Record: record, Line: line, Message: fmt.Sprintf("expected at most %d columns, got %d", len(header), len(row))})
+			continue
+		}
+
+		fields := map[string]interface{}{}
+		attributes := map[string]interface{}{}
+		for i, value := range row {
+			if value == "" {
+				continue
+			}
+			if name, ok := strings.CutPrefix(columnField[i], "attr:"); ok {
+				attributes[name] = value
+			} else {
+				fields[columnField[i]] = value
+			}
+		}
+		if len(attributes) > 0 {
+			fields["attributes"] = attributes
+		}
+
+		product, err := productFromRecord(fields)
+		if err != nil {
+			result.Errors = append(result.Errors, ParseError{Record: record, Line: line, Message: err.Error()})
+			continue
+		}
+		result.Products = append(result.Products, product)
+	}
+	return result, nil
+}
+
+// parseJSON reads a JSON array of product objects, one element at a time so
+// a bad element does not discard the rest.
+func parseJSON(r io.Reader) (ParseResult, error) {
+	var result ParseResult
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		return result, fmt.Errorf("reading JSON: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return result, errors.New("JSON catalog must be an array of products")
+	}
+
+	for record := 1; decoder.More(); record++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			// Malformed JSON leaves the decoder in an unknown position, so
+			// nothing after this point can be trusted.
+			result.Errors = append(result.Errors, ParseError{Record: record, Message: err.Error()})
+			return result, nil
+		}
+
+		product, err := productFromJSON(raw)
+		if err != nil {
+			result.Errors = append(result.Errors, ParseError{Record: record, Message: err.Error()})
+			continue
+		}
+		result.Products = append(result.Products, product)
+	}
+	return result, nil
+}
+
+func parseJSONL(r io.Reader) (ParseResult, error) {
+	var result ParseResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNumber, record := 0, 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record++
+
+		product, err := productFromJSON([]byte(line))
+		if err != nil {
+			result.Errors = append(result.Errors, ParseError{Record: record, Line: lineNumber, Message: err.Error()})
+			continue
+		}
+		result.Products = append(result.Products, product)
+	}
+	return result, scanner.Err()
+}
+
+func productFromJSON(data []byte) (Product, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Product{}, fmt.Errorf("invalid JSON object: %w", err)
+	}
+	return productFromRecord(fields)
+}
+
+// productFromRecord turns a parsed record into a product. Known keys fill the
+// product fields, a "specs" object and keys named after a spec set specs, an
+// "attributes" object and any unknown keys become attributes, specs missing
+// from the record are extracted from the text, a missing category and brand
+// are inferred and the ID is derived.
+func productFromRecord(fields map[string]interface{}) (Product, error) {
+	var product Product
+	attributes := map[string]interface{}{}
+	specs := map[string]interface{}{}
+
+	for key, value := range fields {
+		switch key {
+		case "id", "sku", "name", "description", "category", "brand", "currency", "url", "image_url":
+			s, ok := value.(string)
+			if !ok {
+				return Product{}, fmt.Errorf("%s must be a string", key)
+			}
+			s = strings.TrimSpace(s)
+			switch key {
+			case "id":
+				product.ID = s
+			case "sku":
+				product.SKU = s
+			case "name":
+				product.Name = s
+			case "description":
+				product.Description = s
+			case "category":
+				product.Category = s
+			case "brand":
+				product.Brand = s
+			case "currency":
+				product.Currency = s
+			case "url":
+				product.URL = s
+			case "image_url":
+				product.ImageURL = s
+			}
+		case "price":
+			price, err := parsePrice(value)
+			if err != nil {
+				return Product{}, err
+			}
+			product.Price = &price
+		case "in_stock":
+			inStock, err := parseBool(value)
+			if err != nil {
+				return Product{}, fmt.Errorf("in_stock: %w", err)
+			}
+			product.InStock = &inStock
+		case "tags":
+			tags, err := parseTags(value)
+			if err != nil {
+				return Product{}, err
+			}
+			product.Tags = tags
+		case "created_at", "updated_at":
+			t, err := parseTimestamp(value)
+			if err != nil {
+				return Product{}, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "created_at" {
+				product.CreatedAt = &t
+			} else {
+				product.UpdatedAt = &t
+			}
+		case "attributes":
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				return Product{}, errors.New("attributes must be an object")
+			}
+			for k, v := range nested {
+				attributes[k] = v
+			}
+		case "specs":
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				return Product{}, errors.New("specs must be an object")
+			}
+			coerced, err := coerceSpecs(nested)
+			if err != nil {
+				return Product{}, err
+			}
+			for k, v := range coerced {
+				specs[k] = v
+			}
+		default:
+			// Keys named after a spec are typed columns, not attributes.
+			if def, ok := findSpec(key); ok {
+				coerced, err := coerceSpec(def, value)
+				if err != nil {
+					return Product{}, err
+				}
+				specs[def.Name] = coerced
+				continue
+			}
+			attributes[key] = value
+		}
+	}
+
+	if product.Name == "" {
+		return Product{}, errors.New("name is required")
+	}
+	if err := normalizeProduct(&product); err != nil {
+		return Product{}, err
+	}
+	if product.ID != "" {
+		id, err := uuid.Parse(product.ID)
+		if err != nil {
+			return Product{}, fmt.Errorf("id %q is not a UUID", product.ID)
+		}
+		// Stored IDs are in canonical lower-case form; anything else would
+		// not match its own object on the next sync.
+		product.ID = id.String()
+	}
+	if product.ID == "" {
+		product.ID = productID(product)
+	}
+	if len(attributes) > 0 {
+		product.Attributes = attributes
+	}
+	if len(specs) > 0 {
+		product.Specs = specs
+	}
+	// The category, brand and specs the record leaves out are inferred by
+	// completeProduct, once it is known whether the record changed.
+	product.SourceHash = contentHash(product)
+	return product, nil
+}
+
+// parsePrice accepts a JSON number or a string such as "$1,299.00". Currency
+// symbols are dropped; the currency itself comes from its own field.
+func parsePrice(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		cleaned := strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) || r == '.' || r == '-' {
+				return r
+			}
+			if r == ',' || unicode.IsSpace(r) || unicode.Is(unicode.Sc, r) {
+				return -1
+			}
+			return r
+		}, v)
+		if price, err := strconv.ParseFloat(cleaned, 64); err == nil {
+			return price, nil
+		}
+	}
+	return 0, fmt.Errorf("price %v is not a number", value)
+}
+
+func parseBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes", "y", "1", "in stock":
+			return true, nil
+		case "false", "no", "n", "0", "out of stock":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%v is not a boolean", value)
+}
+
+// parseTags accepts an array of strings or one string separated by commas,
+// semicolons or pipes, as spreadsheets tend to export lists.
+func parseTags(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ';' || r == '|'
+		}), nil
+	case []interface{}:
+		tags := make([]string, 0, len(v))
+		for _, item := range v {
+			tag, ok := item.(string)
+			if !ok {
+				return nil, errors.New("tags must be strings")
+			}
+			tags = append(tags, tag)
+		}
+		return tags, nil
+	}
+	return nil, errors.New("tags must be an array or a delimited string")
+}
+
+// parseTimestamp accepts RFC 3339 timestamps and plain dates.
+func parseTimestamp(value interface{}) (time.Time, error) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.New("must be a string")
+	}
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 timestamp or a date", s)
+}
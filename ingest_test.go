@@ -0,0 +1,281 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkParseResult compares a parse result with the expected products and
+// errors. IDs and source hashes are derived, so they are only checked for
+// being set.
+func checkParseResult(t *testing.T, got ParseResult, want []Product, wantErrors []ParseError) {
+	t.Helper()
+	products := make([]Product, len(got.Products))
+	for i, p := range got.Products {
+		if p.ID == "" || p.SourceHash == "" {
+			t.Errorf("product %q has ID %q and source hash %q, want both set", p.Name, p.ID, p.SourceHash)
+		}
+		p.ID, p.SourceHash = "", ""
+		products[i] = p
+	}
+	if want == nil {
+		want = []Product{}
+	}
+	if !reflect.DeepEqual(products, want) {
+		t.Errorf("products:\n got %+v\nwant %+v", products, want)
+	}
+	if !reflect.DeepEqual(got.Errors, wantErrors) {
+		t.Errorf("errors:\n got %+v\nwant %+v", got.Errors, wantErrors)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	got, err := parseText(strings.NewReader("Dell XPS 13 Laptop - Compact laptop\n\nNo separator\nMacBook Air - Thin laptop\n"))
+	if err != nil {
+		t.Fatalf("parseText: %v", err)
+	}
+	checkParseResult(t, got,
+		[]Product{
+			{Name: "Dell XPS 13 Laptop", Description: "Compact laptop"},
+			{Name: "MacBook Air", Description: "Thin laptop"},
+		},
+		[]ParseError{{Record: 2, Line: 3, Message: `expected "Name - Description"`}},
+	)
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		mapping    ColumnMapping
+		want       []Product
+		wantErrors []ParseError
+	}{
+		{
+			name:  "fields and attributes",
+			input: "\ufeffSKU,Name,Description,Category,Price,Currency,In_Stock,Tags,Color,battery_hours\nWH-1,Sony WH-1000XM5,Headphones,audio,\"$399.00\",usd,yes,Audio;Wireless,black,30\n",
+			want: []Product{{
+				SKU: "WH-1", Name: "Sony WH-1000XM5", Description: "Headphones", Category: "audio", Price: float64Ptr(399), Currency: "USD",
+				InStock: boolPtr(true), Tags: []string{"audio", "wireless"},
+				Attributes: map[string]interface{}{"Color": "black"}, Specs: map[string]interface{}{"battery_hours": 30.0},
+			}},
+		},
+		{
+			name:    "column mapping",
+			input:   "Title,Body,Kind,Cost\nDell XPS 13,Laptop,laptops,999\n",
+			mapping: ColumnMapping{"name": "Title", "description": "Body", "category": "Kind", "price": "Cost"},
+			want:    []Product{{Name: "Dell XPS 13", Description: "Laptop", Category: "laptops", Price: float64Ptr(999)}},
+		},
+		{
+			name:  "empty cells are left out",
+			input: "name,description,category,price\nMacBook Air,,,\n",
+			want:  []Product{{Name: "MacBook Air"}},
+		},
+		{
+			name:  "bad rows are reported and skipped",
+			input: "name,category,price\nGood,misc,10\n,misc,20\nBad price,misc,ten\nToo,misc,1,many\nAlso good,misc,30\n",
+			want:  []Product{{Name: "Good", Category: "misc", Price: float64Ptr(10)}, {Name: "Also good", Category: "misc", Price: float64Ptr(30)}},
+			wantErrors: []ParseError{
+				{Record: 2, Line: 3, Message: "name is required"},
+				{Record: 3, Line: 4, Message: "price ten is not a number"},
+				{Record: 4, Line: 5, Message: "expected at most 3 columns, got 4"},
+			},
+		},
+		{
+			name:  "malformed quoting",
+			input: "name,description\nOne,\"unterminated\nTwo,fine\n",
+			wantErrors: []ParseError{
+				{Record: 1, Line: 3, Message: `extraneous or missing " in quoted-field`},
+			},
+		},
+		{
+			name:  "header only",
+			input: "name,description\n",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCSV(strings.NewReader(tt.input), tt.mapping)
+			if err != nil {
+				t.Fatalf("parseCSV: %v", err)
+			}
+			checkParseResult(t, got, tt.want, tt.wantErrors)
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		want       []Product
+		wantErrors []ParseError
+		wantErr    bool
+	}{
+		{
+			name:  "products",
+			input: `[{"name": "Sony WH-1000XM5", "category": "audio", "price": 399, "in_stock": true, "tags": ["Audio"], "specs": {"noise_cancelling": "yes"}, "color": "black"}, {"name": "JBL Flip 6", "category": "audio", "attributes": {"size": "small"}}]`,
+			want: []Product{
+				{Name: "Sony WH-1000XM5", Category: "audio", Price: float64Ptr(399), InStock: boolPtr(true), Tags: []string{"audio"}, Specs: map[string]interface{}{"noise_cancelling": true}, Attributes: map[string]interface{}{"color": "black"}},
+				{Name: "JBL Flip 6", Category: "audio", Attributes: map[string]interface{}{"size": "small"}},
+			},
+		},
+		{
+			name:  "invalid elements are skipped",
+			input: `[{"name": "Good", "category": "misc"}, {"name": 5}, "text", {"name": "Bad ID", "id": "x"}, {"name": "Also good", "category": "misc"}]`,
+			want:  []Product{{Name: "Good", Category: "misc"}, {Name: "Also good", Category: "misc"}},
+			wantErrors: []ParseError{
+				{Record: 2, Message: "name must be a string"},
+				{Record: 3, Message: "invalid JSON object: json: cannot unmarshal string into Go value of type map[string]interface {}"},
+				{Record: 4, Message: `id "x" is not a UUID`},
+			},
+		},
+		{
+			name:       "malformed JSON stops the parse",
+			input:      `[{"name": "Good", "category": "misc"}, {"name": }, {"name": "Lost"}]`,
+			want:       []Product{{Name: "Good", Category: "misc"}},
+			wantErrors: []ParseError{{Record: 2, Message: "invalid character '}' after array element"}},
+		},
+		{
+			name:    "not an array",
+			input:   `{"name": "Single"}`,
+			wantErr: true,
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJSON(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSON error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			checkParseResult(t, got, tt.want, tt.wantErrors)
+		})
+	}
+}
+
+func TestParseJSONL(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		want       []Product
+		wantErrors []ParseError
+	}{
+		{
+			name:  "one product per line",
+			input: "{\"name\": \"Dell XPS 13\", \"category\": \"laptops\", \"price\": \"$999\"}\n{\"name\": \"MacBook Air\", \"year\": 2024, \"created_at\": \"2024-01-02\"}\n",
+			want: []Product{
+				{Name: "Dell XPS 13", Category: "laptops", Price: float64Ptr(999)},
+				{Name: "MacBook Air", Attributes: map[string]interface{}{"year": 2024.0}, CreatedAt: timePtr("2024-01-02T00:00:00Z")},
+			},
+		},
+		{
+			name:  "blank lines are skipped but counted as lines",
+			input: "\n{\"name\": \"One\", \"category\": \"misc\"}\n\n   \n{\"name\": \"Two\", \"in_stock\": \"maybe\"}\n{bad\n{\"name\": \"Three\", \"category\": \"misc\"}",
+			want:  []Product{{Name: "One", Category: "misc"}, {Name: "Three", Category: "misc"}},
+			wantErrors: []ParseError{
+				{Record: 2, Line: 5, Message: "in_stock: maybe is not a boolean"},
+				{Record: 3, Line: 6, Message: "invalid JSON object: invalid character 'b' looking for beginning of object key string"},
+			},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJSONL(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("parseJSONL: %v", err)
+			}
+			checkParseResult(t, got, tt.want, tt.wantErrors)
+		})
+	}
+}
+
+func TestParsedProductIDs(t *testing.T) {
+	result, err := parseJSONL(strings.NewReader(`{"name": "Dell XPS 13"}
+{"name": "dell  xps 13", "description": "same name, other spacing"}
+{"name": "Dell XPS 13", "sku": "XPS-13"}
+{"name": "Explicit", "id": "5d9c3a4e-1f3b-4c8e-9a2d-7b6e5f4a3c21"}
+{"name": "Upper case", "id": "7A1B2C3D-4E5F-4A6B-8C7D-9E0F1A2B3C4D"}`))
+	if err != nil {
+		t.Fatalf("parseJSONL: %v", err)
+	}
+	ids := make([]string, len(result.Products))
+	for i, p := range result.Products {
+		ids[i] = p.ID
+	}
+
+	if ids[0] != ids[1] {
+		t.Errorf("names differing only in case and spacing got IDs %s and %s", ids[0], ids[1])
+	}
+	if ids[2] == ids[0] {
+		t.Errorf("a SKU should key the product instead of its name")
+	}
+	if ids[3] != "5d9c3a4e-1f3b-4c8e-9a2d-7b6e5f4a3c21" {
+		t.Errorf("explicit ID replaced with %s", ids[3])
+	}
+	if ids[4] != "7a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d" {
+		t.Errorf("upper-case ID kept as %s, want the canonical form", ids[4])
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+		wantErr  bool
+	}{
+		{"documents.txt", formatText, false},
+		{"catalog.CSV", formatCSV, false},
+		{"export.json", formatJSON, false},
+		{"feed.jsonl", formatJSONL, false},
+		{"feed.ndjson", formatJSONL, false},
+		{"catalog.xlsx", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := detectFormat(tt.filename)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("detectFormat(%q) = %q, %v, want %q", tt.filename, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseColumnMapping(t *testing.T) {
+	got, err := parseColumnMapping(" name=Title , description=Body")
+	if err != nil {
+		t.Fatalf("parseColumnMapping: %v", err)
+	}
+	if want := (ColumnMapping{"name": "Title", "description": "Body"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"name", "colour=Color"} {
+		if _, err := parseColumnMapping(s); err == nil {
+			t.Errorf("parseColumnMapping(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func timePtr(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
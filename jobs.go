@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Job statuses
+const (
+	jobPending   = "pending"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+)
+
+// maxJobErrors caps the errors kept per job so a bad file cannot exhaust
+// memory; the counters stay exact.
+const maxJobErrors = 1000
+
+// maxRetainedJobs is how many jobs are remembered before the oldest finished
+// ones are forgotten.
+const maxRetainedJobs = 100
+
+// jobState is what every background job reports about itself.
+type jobState struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func (s *jobState) state() *jobState { return s }
+
+// registeredJob is implemented by the pointer types of jobs kept in a
+// jobRegistry.
+type registeredJob[J any] interface {
+	*J
+	state() *jobState
+	// clone returns a copy that shares no slices with the job, so it can be
+	// serialized while the job keeps running.
+	clone() J
+}
+
+// jobRegistry remembers background jobs of one kind in memory. An exclusive
+// registry runs one job at a time.
+type jobRegistry[J any, P registeredJob[J]] struct {
+	mu        sync.Mutex
+	jobs      map[string]P
+	order     []string
+	exclusive bool
+	running   string
+}
+
+func newJobRegistry[J any, P registeredJob[J]](exclusive bool) *jobRegistry[J, P] {
+	return &jobRegistry[J, P]{jobs: make(map[string]P), exclusive: exclusive}
+}
+
+// create registers a pending job, set up by init. An exclusive registry
+// returns the ID of the unfinished job instead while there is one.
+func (r *jobRegistry[J, P]) create(init func(job P)) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.exclusive && r.running != "" {
+		return r.running, false
+	}
+	job := P(new(J))
+	*job.state() = jobState{
+		ID:        uuid.NewString(),
+		Status:    jobPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if init != nil {
+		init(job)
+	}
+	id := job.state().ID
+	r.jobs[id] = job
+	r.order = append(r.order, id)
+	if r.exclusive {
+		r.running = id
+	}
+	r.prune()
+	return id, true
+}
+
+// prune forgets the oldest finished jobs beyond maxRetainedJobs. Callers must
+// hold the lock.
+func (r *jobRegistry[J, P]) prune() {
+	for i := 0; len(r.order) > maxRetainedJobs && i < len(r.order); {
+		job := r.jobs[r.order[i]].state()
+		if job.Status != jobCompleted && job.Status != jobFailed {
+			i++
+			continue
+		}
+		delete(r.jobs, job.ID)
+		r.order = append(r.order[:i], r.order[i+1:]...)
+	}
+}
+
+// get returns a snapshot of the job that is safe to serialize.
+func (r *jobRegistry[J, P]) get(id string) (J, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		var zero J
+		return zero, false
+	}
+	return job.clone(), true
+}
+
+func (r *jobRegistry[J, P]) update(id string, fn func(job P)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+// begin marks the job as running.
+func (r *jobRegistry[J, P]) begin(id string) {
+	started := time.Now().UTC()
+	r.update(id, func(job P) {
+		job.state().Status = jobRunning
+		job.state().StartedAt = &started
+	})
+}
+
+// finish marks the job as completed, or failed with err, and returns its
+// final state.
+func (r *jobRegistry[J, P]) finish(id string, err error) J {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running == id {
+		r.running = ""
+	}
+	job, ok := r.jobs[id]
+	if !ok {
+		var zero J
+		return zero
+	}
+	state := job.state()
+	finished := time.Now().UTC()
+	state.FinishedAt = &finished
+	state.Status = jobCompleted
+	if err != nil {
+		state.Status = jobFailed
+		state.Error = err.Error()
+	}
+	return job.clone()
+}
+
+// IngestJob tracks one background catalog ingestion.
+type IngestJob struct {
+	jobState
+	Source string `json:"source"`
+	Format string `json:"format"`
+	// Total is the number of products parsed from the source.
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	Inserted  int `json:"inserted"`
+	Failed    int `json:"failed"`
+	// Skipped counts records that could not be parsed into products.
+	Skipped      int           `json:"skipped"`
+	ParseErrors  []ParseError  `json:"parse_errors"`
+	ObjectErrors []ObjectError `json:"object_errors"`
+}
+
+func (j *IngestJob) clone() IngestJob {
+	snapshot := *j
+	snapshot.ParseErrors = append([]ParseError{}, j.ParseErrors...)
+	snapshot.ObjectErrors = append([]ObjectError{}, j.ObjectErrors...)
+	return snapshot
+}
+
+var ingestJobs = newJobRegistry[IngestJob](false)
+
+// createIngestJob registers a pending ingestion of source.
+func createIngestJob(source, format string) string {
+	id, _ := ingestJobs.create(func(job *IngestJob) {
+		job.Source = source
+		job.Format = format
+		job.ParseErrors = []ParseError{}
+		job.ObjectErrors = []ObjectError{}
+	})
+	return id
+}
+
+// runIngestJob ingests the spooled catalog at path and removes the file when
+// done.
+func runIngestJob(jobID, path, format string, mapping ColumnMapping) {
+	defer os.Remove(path)
+	ingestFile(jobID, path, format, mapping)
+}
+
+// ingestFile parses the catalog at path and writes it to the store in chunks,
+// recording progress and failures on the job.
+func ingestFile(jobID, path, format string, mapping ColumnMapping) {
+	ingestJobs.begin(jobID)
+
+	result, err := parseSpooledCatalog(path, format, mapping)
+	if err != nil {
+		finishJob(jobID, err)
+		return
+	}
+
+	ingestJobs.update(jobID, func(job *IngestJob) {
+		job.Total = len(result.Products)
+		job.Skipped = len(result.Errors)
+		job.ParseErrors = appendCapped(job.ParseErrors, result.Errors...)
+	})
+
+	// Progress is recorded after every chunk so the job can be polled.
+	record := func(size int, failed []ObjectError) {
+		ingestJobs.update(jobID, func(job *IngestJob) {
+			job.Processed += size
+			job.Inserted += size - len(failed)
+			job.Failed += len(failed)
+			job.ObjectErrors = appendCapped(job.ObjectErrors, failed...)
+		})
+	}
+
+	// Categories and specs are inferred one chunk at a time, right before
+	// the chunk is written, so a large file shows progress from the start
+	// instead of after every product has been through the models.
+	ctx := context.Background()
+	writer := newBatchWriter()
+	for start := 0; start < len(result.Products); start += writer.chunkSize {
+		end := start + writer.chunkSize
+		if end > len(result.Products) {
+			end = len(result.Products)
+		}
+		chunk := result.Products[start:end]
+
+		if err := completeProducts(ctx, chunk); err != nil {
+			failed := make([]ObjectError, len(chunk))
+			for i, product := range chunk {
+				failed[i] = ObjectError{ID: productKey(product), Name: product.Name, Message: err.Error()}
+			}
+			record(len(chunk), failed)
+			continue
+		}
+		writer.write(ctx, chunk, record)
+	}
+
+	finishJob(jobID, nil)
+}
+
+func parseSpooledCatalog(path, format string, mapping ColumnMapping) (ParseResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ParseResult{}, err
+	}
+	defer file.Close()
+
+	return parseCatalog(file, format, mapping)
+}
+
+func finishJob(jobID string, err error) {
+	job := ingestJobs.finish(jobID, err)
+	log.Printf("Ingest job %s %s: %d inserted, %d failed, %d skipped", job.ID, job.Status, job.Inserted, job.Failed, job.Skipped)
+}
+
+func appendCapped[T any](existing []T, items ...T) []T {
+	room := maxJobErrors - len(existing)
+	if room <= 0 {
+		return existing
+	}
+	if len(items) > room {
+		items = items[:room]
+	}
+	return append(existing, items...)
+}
+
+// contentTypeFormats maps upload content types onto catalog formats.
+var contentTypeFormats = map[string]string{
+	"text/plain":           formatText,
+	"text/csv":             formatCSV,
+	"application/json":     formatJSON,
+	"application/x-ndjson": formatJSONL,
+	"application/jsonl":    formatJSONL,
+}
+
+// startIngest accepts a catalog as a multipart "file" field or as the raw
+// request body, spools it to disk and ingests it in the background. The
+// format comes from the format query parameter, the file name or the
+// content type, in that order.
+func startIngest(c *gin.Context) {
+	mapping, err := parseColumnMapping(c.Query("mapping"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxBytes := int64(getEnvInt("INGEST_MAX_BYTES", 100<<20))
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+
+	var body io.Reader
+	source := c.Query("filename")
+	contentType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	if contentType == "multipart/form-data" {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "multipart upload needs a file field"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		body = file
+		source = fileHeader.Filename
+		contentType, _, _ = mime.ParseMediaType(fileHeader.Header.Get("Content-Type"))
+	} else {
+		body = c.Request.Body
+	}
+
+	format := c.Query("format")
+	if format == "" && source != "" {
+		format, _ = detectFormat(source)
+	}
+	if format == "" {
+		format = contentTypeFormats[contentType]
+	}
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot determine catalog format; pass ?format=text|csv|json|jsonl"})
+		return
+	}
+	if !isCatalogFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown catalog format %q", format)})
+		return
+	}
+
+	path, err := spool(body)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if source == "" {
+		source = "upload"
+	}
+	jobID := createIngestJob(source, format)
+	go runIngestJob(jobID, path, format, mapping)
+
+	c.Header("Location", "/ingest/jobs/"+jobID)
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "status": jobPending})
+}
+
+// spool copies an upload to a temporary file so it outlives the request.
+func spool(body io.Reader) (string, error) {
+	file, err := os.CreateTemp("", "ingest-*")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, body); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("reading upload: %w", err)
+	}
+	return file.Name(), nil
+}
+
+func getIngestJob(c *gin.Context) {
+	job, ok := ingestJobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
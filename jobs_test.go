@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newIngestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/ingest", startIngest)
+	r.GET("/ingest/jobs/:id", getIngestJob)
+	return r
+}
+
+func acceptedJobID(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	return accepted.JobID
+}
+
+// waitForJob polls the job endpoint until the job finishes.
+func waitForJob(t *testing.T, r http.Handler, id string) IngestJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := serve(r, http.MethodGet, "/ingest/jobs/"+id, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("job status %d: %s", w.Code, w.Body)
+		}
+		var job IngestJob
+		if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == jobCompleted || job.Status == jobFailed {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIngestUpload(t *testing.T) {
+	s := useMemoryStore(t)
+	r := newIngestRouter()
+
+	catalog := `{"name": "Dell XPS 13", "category": "laptops"}
+{"name": "MacBook Air", "category": "laptops"}
+{"category": "laptops"}
+`
+	w := serve(r, http.MethodPost, "/ingest?format=jsonl", catalog)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	id := acceptedJobID(t, w)
+	if got := w.Header().Get("Location"); got != "/ingest/jobs/"+id {
+		t.Errorf("Location %q", got)
+	}
+
+	job := waitForJob(t, r, id)
+	if job.Status != jobCompleted || job.Total != 2 || job.Processed != 2 || job.Inserted != 2 || job.Skipped != 1 {
+		t.Errorf("job %+v, want 2 inserted and 1 skipped", job)
+	}
+	if len(job.ParseErrors) != 1 || job.ParseErrors[0].Message != "name is required" {
+		t.Errorf("parse errors %+v", job.ParseErrors)
+	}
+	if count, _ := s.Count(context.Background(), nil); count != 2 {
+		t.Errorf("store holds %d products, want 2", count)
+	}
+}
+
+func TestIngestUploadErrors(t *testing.T) {
+	useMemoryStore(t)
+	r := newIngestRouter()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"unknown format", "/ingest?format=xml", http.StatusBadRequest},
+		{"format from the file name", "/ingest?filename=catalog.jsonl", http.StatusAccepted},
+		{"undetectable format", "/ingest?filename=catalog.xlsx", http.StatusBadRequest},
+		{"unknown content type", "/ingest", http.StatusBadRequest},
+		{"bad mapping", "/ingest?format=csv&mapping=colour", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"name": "One"}`))
+			req.Header.Set("Content-Type", "application/octet-stream")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code == http.StatusAccepted {
+				waitForJob(t, r, acceptedJobID(t, w))
+			}
+		})
+	}
+
+	if w := serve(r, http.MethodGet, "/ingest/jobs/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", w.Code)
+	}
+}
+
+func TestJobRegistry(t *testing.T) {
+	r := newJobRegistry[IngestJob](true)
+
+	first, created := r.create(func(job *IngestJob) { job.Source = "first" })
+	if !created {
+		t.Fatalf("first job not created")
+	}
+	if running, created := r.create(nil); created || running != first {
+		t.Errorf("second job while one runs: got %s, %t, want %s, false", running, created, first)
+	}
+
+	r.begin(first)
+	r.update(first, func(job *IngestJob) {
+		job.ObjectErrors = append(job.ObjectErrors, ObjectError{Name: "Dell XPS 13"})
+	})
+	snapshot, _ := r.get(first)
+	r.update(first, func(job *IngestJob) { job.ObjectErrors[0].Name = "changed" })
+	if snapshot.Status != jobRunning || snapshot.StartedAt == nil || snapshot.Source != "first" || snapshot.ObjectErrors[0].Name != "Dell XPS 13" {
+		t.Errorf("snapshot %+v, want the running job unaffected by later updates", snapshot)
+	}
+
+	finished := r.finish(first, errors.New("disk full"))
+	if finished.Status != jobFailed || finished.Error != "disk full" || finished.FinishedAt == nil {
+		t.Errorf("finished job %+v, want failed with the error", finished)
+	}
+	if _, created := r.create(nil); !created {
+		t.Errorf("no job created after the running one finished")
+	}
+}
+
+func TestJobRegistryPrunes(t *testing.T) {
+	r := newJobRegistry[IngestJob](false)
+
+	unfinished, _ := r.create(nil)
+	var oldest string
+	for i := 0; i < maxRetainedJobs+5; i++ {
+		id, _ := r.create(nil)
+		if i == 0 {
+			oldest = id
+		}
+		r.finish(id, nil)
+	}
+	// Pruning happens when jobs are created.
+	r.create(nil)
+
+	if len(r.jobs) != maxRetainedJobs {
+		t.Errorf("%d jobs kept, want %d", len(r.jobs), maxRetainedJobs)
+	}
+	if _, ok := r.get(unfinished); !ok {
+		t.Errorf("unfinished job was pruned")
+	}
+	if _, ok := r.get(oldest); ok {
+		t.Errorf("oldest finished job was kept")
+	}
+}
+
+// storeSizeCategorizer records how many products are stored each time it is
+// asked for a category.
+type storeSizeCategorizer struct {
+	seen []int
+}
+
+func (c *storeSizeCategorizer) Categorize(ctx context.Context, p Product) (Categorization, error) {
+	n, err := store.Count(ctx, nil)
+	if err != nil {
+		return Categorization{}, err
+	}
+	c.seen = append(c.seen, n)
+	return Categorization{Category: "gaming", Confidence: 1, Source: "test"}, nil
+}
+
+func TestIngestFileInfersPerChunk(t *testing.T) {
+	useMemoryStore(t)
+	c := &storeSizeCategorizer{}
+	useCategorizer(t, c)
+	t.Setenv("INGEST_BATCH_SIZE", "2")
+
+	path := filepath.Join(t.TempDir(), "catalog.txt")
+	catalog := "One - First\nTwo - Second\nThree - Third\nFour - Fourth\nFive - Fifth\n"
+	if err := os.WriteFile(path, []byte(catalog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobID := createIngestJob("test", formatText)
+	ingestFile(jobID, path, formatText, nil)
+
+	job, _ := ingestJobs.get(jobID)
+	if job.Status != jobCompleted || job.Inserted != 5 {
+		t.Fatalf("job %+v, want 5 inserted", job)
+	}
+	// Each chunk is categorized after the previous one was written.
+	if want := []int{0, 0, 2, 2, 4}; !reflect.DeepEqual(c.seen, want) {
+		t.Errorf("categorized with %v products stored, want %v", c.seen, want)
+	}
+}
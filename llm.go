@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var llmClient = &http.Client{Timeout: 30 * time.Second}
+
+// chatCompletion sends a single-turn prompt to the OpenAI chat completions API
+// and returns the reply text.
+func chatCompletion(ctx context.Context, prompt string, maxTokens int) (string, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return "", errors.New("OPENAI_API_KEY is not set")
+	}
+
+	reqBody := OpenAIRequest{
+		Model: getEnv("LLM_MODEL", "gpt-3.5-turbo"),
+		Messages: []Message{
+			{Role: "user", Content: prompt},
+		},
+		Temperature: 0.1,
+		MaxTokens:   maxTokens,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("marshaling OpenAI request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("creating OpenAI request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := llmClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("calling OpenAI API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("OpenAI API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var openaiResp OpenAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
+		return "", fmt.Errorf("decoding OpenAI response: %w", err)
+	}
+	if len(openaiResp.Choices) == 0 {
+		return "", errors.New("OpenAI response has no choices")
+	}
+	return strings.TrimSpace(openaiResp.Choices[0].Message.Content), nil
+}
+
+// stripCodeFence removes the Markdown code fence models sometimes wrap JSON
+// replies in.
+func stripCodeFence(reply string) string {
+	reply = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(reply), "```json"), "```")
+	return strings.TrimSpace(strings.TrimSuffix(reply, "```"))
+}
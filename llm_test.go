@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestStripCodeFence(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{`{"category": "laptops"}`, `{"category": "laptops"}`},
+		{"```json\n{\"category\": \"laptops\"}\n```", `{"category": "laptops"}`},
+		{"```\n{\"ram_gb\": 16}\n```\n", `{"ram_gb": 16}`},
+		{"  {\"ram_gb\": 16}  ", `{"ram_gb": 16}`},
+	}
+
+	for _, tt := range tests {
+		if got := stripCodeFence(tt.reply); got != tt.want {
+			t.Errorf("stripCodeFence(%q) = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
@@ -1,59 +1,100 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"github.com/weaviate/weaviate-go-client/v4/weaviate"
-	"github.com/weaviate/weaviate-go-client/v4/weaviate/auth"
-	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
-	"github.com/weaviate/weaviate/entities/models"
 )
 
 type Product struct {
 	ID          string `json:"id"`
+	SKU         string `json:"sku,omitempty"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Category    string `json:"category"`
+	// CategoryPath is the category's path in the taxonomy, from the root.
+	CategoryPath []string `json:"category_path,omitempty"`
+	Brand        string   `json:"brand,omitempty"`
+	// Price is in the product's Currency, an ISO 4217 code such as "USD".
+	Price    *float64 `json:"price,omitempty"`
+	Currency string   `json:"currency,omitempty"`
+	InStock  *bool    `json:"in_stock,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	ImageURL string   `json:"image_url,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Specs are typed facts such as battery_hours, extracted from the text
+	// or supplied by the catalog. See specDefinitions.
+	Specs map[string]interface{} `json:"specs,omitempty"`
+	// Attributes holds extra catalog fields that have no dedicated property.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// CreatedAt and UpdatedAt are kept by the service: UpdatedAt only moves
+	// when the product's content changes.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// ContentHash is the hash stored with the product at its last write.
+	ContentHash string `json:"-"`
+	// SourceHash is the content hash of the catalog record the product was
+	// last synced from, taken before the category, brand and specs were
+	// inferred. It is empty for products written through the API.
+	SourceHash string `json:"-"`
+	// Relevance is only set on search and recommendation results.
+	Relevance *Relevance `json:"relevance,omitempty"`
+}
+
+// Relevance describes how well a result matched. Vector searches report
+// distance and certainty, keyword and hybrid searches report a score.
+type Relevance struct {
+	Distance     *float64 `json:"distance,omitempty"`
+	Certainty    *float64 `json:"certainty,omitempty"`
+	Score        *float64 `json:"score,omitempty"`
+	ExplainScore string   `json:"explain_score,omitempty"`
 }
 
 type SearchRequest struct {
-	Query string `json:"query"`
-	Limit int    `json:"limit"`
+	Query   string         `json:"query"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	Cursor  string         `json:"cursor"`
+	Filters *SearchFilters `json:"filters"`
+	// Mode is "vector" (default), "keyword" (BM25) or "hybrid".
+	Mode string `json:"mode"`
+	// Alpha weights hybrid search: 1 is pure vector, 0 is pure keyword.
+	Alpha *float32 `json:"alpha"`
+	// MinCertainty and MaxDistance drop weak vector matches.
+	MinCertainty *float64 `json:"min_certainty"`
+	MaxDistance  *float64 `json:"max_distance"`
+	// Interpret turns price, brand and category phrases in the query into
+	// filters.
+	Interpret bool `json:"interpret"`
 }
 
 type SearchResponse struct {
 	Products []Product `json:"products"`
 	Count    int       `json:"count"`
+	// Total is the number of products matching the filters, across all pages.
+	// Searches leave it out when it would overcount, see searchProducts.
+	Total int `json:"total,omitempty"`
+	// NextCursor fetches the following page; it is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Interpretation shows how the query was parsed, when it was.
+	Interpretation *QueryInterpretation `json:"interpretation,omitempty"`
 }
 
-var client *weaviate.Client
-
-func initWeaviate() {
-	cfg := weaviate.Config{
-		Host:   getEnv("WEAVIATE_HOST", "localhost:8080"),
-		Scheme: "http",
-	}
+func initStore() {
+	store = newVectorStore(newEmbedder())
 
-	if apiKey := os.Getenv("WEAVIATE_API_KEY"); apiKey != "" {
-		cfg.AuthConfig = auth.ApiKey{Value: apiKey}
+	if err := store.EnsureSchema(context.Background()); err != nil {
+		log.Printf("Error ensuring schema: %v", err)
 	}
 
-	client = weaviate.New(cfg)
-
-	createSchema()
-	
+	loadCategoryReviews(context.Background())
 	loadProducts()
 }
 
@@ -64,128 +105,58 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func createSchema() {
-	className := "Product"
-	
-	exists, err := client.Schema().ClassExistenceChecker().WithClassName(className).Do(context.Background())
+// loadProducts syncs the catalog file into the index at startup. Only new and
+// changed products are written, so restarts are cheap and edits to the file
+// always reach the index.
+func loadProducts() {
+	path := getEnv("CATALOG_FILE", "documents.txt")
+	format, err := detectFormat(path)
 	if err != nil {
-		log.Printf("Error checking class existence: %v", err)
-		return
-	}
-	
-	if exists {
-		log.Printf("Class %s already exists", className)
+		log.Printf("Error loading catalog: %v", err)
 		return
 	}
 
-	classObj := &models.Class{
-		Class: className,
-		Properties: []*models.Property{
-			{
-				Name:     "name",
-				DataType: []string{"text"},
-			},
-			{
-				Name:     "description",
-				DataType: []string{"text"},
-			},
-			{
-				Name:     "category",
-				DataType: []string{"text"},
-			},
-		},
-		Vectorizer: "text2vec-openai",
-	}
-
-	err = client.Schema().ClassCreator().WithClass(classObj).Do(context.Background())
+	mapping, err := parseColumnMapping(os.Getenv("CATALOG_CSV_MAPPING"))
 	if err != nil {
-		log.Printf("Error creating schema: %v", err)
-	} else {
-		log.Printf("Schema created successfully")
-	}
-}
-
-func loadProducts() {
-	result, err := client.GraphQL().Aggregate().WithClassName("Product").WithFields(graphql.Field{Name: "meta", Fields: []graphql.Field{{Name: "count"}}}).Do(context.Background())
-	if err == nil {
-		if data, ok := result.Data["Aggregate"].(map[string]interface{}); ok {
-			if products, ok := data["Product"].([]interface{}); ok && len(products) > 0 {
-				if product, ok := products[0].(map[string]interface{}); ok {
-					if meta, ok := product["meta"].(map[string]interface{}); ok {
-						if count, ok := meta["count"].(float64); ok && count > 0 {
-							log.Printf("Products already loaded: %v", count)
-							return
-						}
-					}
-				}
-			}
-		}
+		log.Printf("Error loading catalog: %v", err)
+		return
 	}
 
-	file, err := os.Open("documents.txt")
+	file, err := os.Open(path)
 	if err != nil {
-		log.Printf("Error opening documents.txt: %v", err)
+		log.Printf("Error opening %s: %v", path, err)
 		return
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	products := []Product{}
-	id := 1
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		parts := strings.SplitN(line, " - ", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		name := parts[0]
-		description := parts[1]
-		category := categorizeProduct(name, description)
-
-		product := Product{
-			ID:          strconv.Itoa(id),
-			Name:        name,
-			Description: description,
-			Category:    category,
-		}
-
-		products = append(products, product)
-		id++
+	result, err := parseCatalog(file, format, mapping)
+	if err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+		return
+	}
+	for _, parseErr := range result.Errors {
+		log.Printf("Skipping %s %v", path, parseErr)
 	}
 
-	batcher := client.Batch().ObjectsBatcher()
-	for _, product := range products {
-		obj := &models.Object{
-			Class: "Product",
-			Properties: map[string]interface{}{
-				"name":        product.Name,
-				"description": product.Description,
-				"category":    product.Category,
-			},
-		}
-		batcher = batcher.WithObject(obj)
+	// Deleting products that failed to parse would drop them from the index
+	// because of a typo, so deletion only runs on a clean parse.
+	deleteMissing := os.Getenv("CATALOG_SYNC_DELETE") == "true"
+	if deleteMissing && (len(result.Errors) > 0 || len(result.Products) == 0) {
+		log.Printf("Not deleting missing products: %s has %d parse errors and %d products", path, len(result.Errors), len(result.Products))
+		deleteMissing = false
 	}
 
-	_, err = batcher.Do(context.Background())
+	summary, err := syncCatalog(context.Background(), result.Products, deleteMissing)
 	if err != nil {
-		log.Printf("Error batch inserting products: %v", err)
-	} else {
-		log.Printf("Successfully loaded %d products", len(products))
+		log.Printf("Error syncing %s: %v", path, err)
+		return
 	}
+	logSyncSummary(path, summary)
 }
 
-// Predefined categories for consistent classification
-var productCategories = []string{
-	"smartphones", "laptops", "tablets", "audio", "wearables",
-	"cameras", "gaming", "automotive", "appliances", "fitness",
-	"e-readers", "smart-home", "accessories", "electronics",
-}
+// productCategories are the categories products are classified into: every
+// node of the taxonomy, depth first.
+var productCategories = taxonomy.names
 
 // OpenAI API structures
 type OpenAIRequest struct {
@@ -208,151 +179,119 @@ type Choice struct {
 	Message Message `json:"message"`
 }
 
-// AI-powered categorization using OpenAI
-func categorizeProductAI(name, description string) string {
-	// Create prompt for categorization
-	prompt := fmt.Sprintf(`Categorize this product into one of these categories: %s
-
-Product: %s
-Description: %s
-
-Return only the category name that best fits this product. Choose the most specific and appropriate category.`,
-		strings.Join(productCategories, ", "), name, description)
-
-	reqBody := OpenAIRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []Message{
-			{Role: "user", Content: prompt},
-		},
-		Temperature: 0.1,
-		MaxTokens:   50,
+func searchProducts(c *gin.Context) {
+	var req SearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	jsonData, err := json.Marshal(reqBody)
+	limit, err := checkLimit(req.Limit, 10)
 	if err != nil {
-		log.Printf("Error marshaling OpenAI request: %v", err)
-		return categorizeProductFallback(name)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	req.Limit = limit
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Error creating OpenAI request: %v", err)
-		return categorizeProductFallback(name)
+	if err := req.Filters.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error calling OpenAI API: %v", err)
-		return categorizeProductFallback(name)
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Offset = cursor.Offset
 	}
-	defer resp.Body.Close()
-
-	var openaiResp OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
-		log.Printf("Error decoding OpenAI response: %v", err)
-		return categorizeProductFallback(name)
+	if req.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset cannot be negative"})
+		return
 	}
 
-	if len(openaiResp.Choices) > 0 {
-		category := strings.ToLower(strings.TrimSpace(openaiResp.Choices[0].Message.Content))
-		
-		for _, validCategory := range productCategories {
-			if category == validCategory {
-				return category
-			}
-		}
+	alpha := float32(0.5)
+	if req.Alpha != nil {
+		alpha = *req.Alpha
 	}
-
-	return categorizeProductFallback(name)
-}
-
-func categorizeProductFallback(name string) string {
-	name = strings.ToLower(name)
-	
-	categories := map[string][]string{
-		"smartphones": {"phone", "iphone", "galaxy", "pixel", "oneplus", "samsung", "mobile"},
-		"laptops":     {"laptop", "macbook", "thinkpad", "surface pro", "notebook", "chromebook"},
-		"tablets":     {"ipad", "tablet", "surface", "kindle fire"},
-		"audio":       {"airpods", "headphones", "earbuds", "speaker", "soundbar", "audio", "beats", "sony wh"},
-		"wearables":   {"watch", "fitbit", "band", "tracker", "smartwatch", "apple watch"},
-		"cameras":     {"camera", "gopro", "canon", "nikon", "photography", "lens"},
-		"gaming":      {"console", "nintendo", "playstation", "xbox", "gaming", "switch"},
-		"automotive":  {"tesla", "car", "vehicle", "auto"},
-		"appliances":  {"vacuum", "roomba", "dyson", "cleaner", "kitchenaid", "mixer"},
-		"fitness":     {"bike", "peloton", "treadmill", "exercise", "workout", "fitness"},
-		"e-readers":   {"kindle", "e-reader", "ebook"},
-		"smart-home":  {"alexa", "echo", "nest", "smart", "home"},
+	if alpha < 0 || alpha > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "alpha must be between 0 and 1"})
+		return
 	}
 
-	for category, keywords := range categories {
-		for _, keyword := range keywords {
-			if strings.Contains(name, keyword) {
-				return category
-			}
+	if req.MinCertainty != nil || req.MaxDistance != nil {
+		if req.Mode != "" && req.Mode != "vector" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_certainty and max_distance only apply to vector mode"})
+			return
+		}
+		if req.MinCertainty != nil && (*req.MinCertainty < 0 || *req.MinCertainty > 1) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_certainty must be between 0 and 1"})
+			return
+		}
+		if req.MaxDistance != nil && (*req.MaxDistance < 0 || *req.MaxDistance > 2) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_distance must be between 0 and 2"})
+			return
 		}
 	}
-	
-	return "electronics"
-}
-
-func categorizeProduct(name, description string) string {
-	// For production: use AI categorization
-	// For development: uncomment the line below to use AI
-	// return categorizeProductAI(name, description)
-	
-	return categorizeProductFallback(name)
-}
 
-func searchProducts(c *gin.Context) {
-	var req SearchRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	query, filters := req.Query, req.Filters
+	var interpretation *QueryInterpretation
+	if query != "" && req.Interpret {
+		parsed := parseQuery(query)
+		filters = parsed.applyTo(req.Filters)
+		// A query that was all constraints, e.g. "under $50", is searched
+		// as written.
+		if parsed.Text == "" {
+			parsed.Text = query
+		}
+		query = parsed.Text
+		interpretation = &parsed
+	}
+
+	opts := SearchOptions{
+		Limit:        req.Limit,
+		Offset:       req.Offset,
+		Filters:      filters,
+		MinCertainty: req.MinCertainty,
+		MaxDistance:  req.MaxDistance,
+	}
+
+	var products []Product
+	switch req.Mode {
+	case "", "vector":
+		products, err = store.NearText(c.Request.Context(), query, opts)
+	case "keyword":
+		products, err = store.Keyword(c.Request.Context(), query, opts)
+	case "hybrid":
+		products, err = store.Hybrid(c.Request.Context(), query, alpha, opts)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be vector, keyword or hybrid"})
 		return
 	}
-
-	if req.Limit == 0 {
-		req.Limit = 10
-	}
-
-	nearText := client.GraphQL().NearTextArgBuilder().
-		WithConcepts([]string{req.Query})
-	
-	result, err := client.GraphQL().Get().
-		WithClassName("Product").
-		WithFields(graphql.Field{Name: "name"}, graphql.Field{Name: "description"}, graphql.Field{Name: "category"}).
-		WithNearText(nearText).
-		WithLimit(req.Limit).
-		Do(context.Background())
-
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	products := []Product{}
-	if data, ok := result.Data["Get"].(map[string]interface{}); ok {
-		if productData, ok := data["Product"].([]interface{}); ok {
-			for i, item := range productData {
-				if productMap, ok := item.(map[string]interface{}); ok {
-					product := Product{
-						ID:          strconv.Itoa(i + 1),
-						Name:        getString(productMap, "name"),
-						Description: getString(productMap, "description"),
-						Category:    getString(productMap, "category"),
-					}
-					products = append(products, product)
-				}
-			}
+	response := SearchResponse{
+		Products:       products,
+		Count:          len(products),
+		Interpretation: interpretation,
+	}
+	// Vector and hybrid searches rank every product that passes the filters,
+	// so those are the total. Keyword searches and similarity cutoffs drop
+	// products, and there is no cheap count of what they keep.
+	if req.Mode != "keyword" && req.MinCertainty == nil && req.MaxDistance == nil {
+		response.Total, err = store.Count(c.Request.Context(), filters)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 	}
-
-	response := SearchResponse{
-		Products: products,
-		Count:    len(products),
+	// A short page means the ranking is exhausted.
+	if len(products) == req.Limit {
+		response.NextCursor = encodeCursor(pageCursor{Offset: req.Offset + len(products)})
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -365,45 +304,18 @@ func getRecommendations(c *gin.Context) {
 		return
 	}
 
-	limit := 5
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
-		}
+	limit, err := queryLimit(c, 5)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	nearText := client.GraphQL().NearTextArgBuilder().
-		WithConcepts([]string{productName})
-	
-	result, err := client.GraphQL().Get().
-		WithClassName("Product").
-		WithFields(graphql.Field{Name: "name"}, graphql.Field{Name: "description"}, graphql.Field{Name: "category"}).
-		WithNearText(nearText).
-		WithLimit(limit).
-		Do(context.Background())
-
+	products, err := store.NearText(c.Request.Context(), productName, SearchOptions{Limit: limit})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	products := []Product{}
-	if data, ok := result.Data["Get"].(map[string]interface{}); ok {
-		if productData, ok := data["Product"].([]interface{}); ok {
-			for i, item := range productData {
-				if productMap, ok := item.(map[string]interface{}); ok {
-					product := Product{
-						ID:          strconv.Itoa(i + 1),
-						Name:        getString(productMap, "name"),
-						Description: getString(productMap, "description"),
-						Category:    getString(productMap, "category"),
-					}
-					products = append(products, product)
-				}
-			}
-		}
-	}
-
 	response := SearchResponse{
 		Products: products,
 		Count:    len(products),
@@ -433,22 +345,45 @@ func main() {
 		log.Println("No .env file found")
 	}
 
-	initWeaviate()
+	initTaxonomy()
+	initCategorizer()
+	initStore()
+	startDirWatcher()
 
 	r := gin.Default()
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		AllowCredentials: true,
 	}))
 
 	r.GET("/health", healthCheck)
+	r.GET("/categories", listCategories)
+	r.POST("/categories/recategorize", startRecategorize)
+	r.GET("/categories/recategorize/jobs/:id", getRecategorizeJob)
+	r.GET("/categories/review", listCategoryReviews)
+	r.POST("/categories/review/:id/accept", acceptCategoryReview)
+	r.POST("/categories/review/:id/reject", rejectCategoryReview)
+	r.POST("/ingest", startIngest)
+	r.GET("/ingest/jobs/:id", getIngestJob)
+	r.POST("/reindex", startReindex)
+	r.GET("/reindex/jobs/:id", getReindexJob)
+	r.POST("/reindex/rollback", rollbackReindex)
 	r.POST("/search", searchProducts)
 	r.GET("/recommendations", getRecommendations)
+	r.POST("/recommendations", recommendForBasket)
+
+	r.GET("/products", listProducts)
+	r.POST("/products", createProduct)
+	r.GET("/products/:id", getProduct)
+	r.GET("/products/:id/similar", getSimilarProducts)
+	r.PUT("/products/:id", replaceProduct)
+	r.PATCH("/products/:id", patchProduct)
+	r.DELETE("/products/:id", deleteProduct)
 
 	port := getEnv("PORT", "8080")
 	fmt.Printf("Server starting on port %s\n", port)
 	log.Fatal(r.Run(":" + port))
-}
\ No newline at end of file
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageCursor is the state behind the opaque cursors handed to clients.
+// Ranked searches resume from an offset; listings resume after an object ID.
+type pageCursor struct {
+	Offset int    `json:"o,omitempty"`
+	After  string `json:"a,omitempty"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// maxPageSize caps the limit of searches and listings.
+const maxPageSize = 100
+
+var errInvalidLimit = fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+
+// checkLimit returns fallback for a limit left out of a request body (zero)
+// and rejects one outside 1..maxPageSize.
+func checkLimit(limit, fallback int) (int, error) {
+	if limit == 0 {
+		return fallback, nil
+	}
+	if limit < 0 || limit > maxPageSize {
+		return 0, errInvalidLimit
+	}
+	return limit, nil
+}
+
+// queryLimit reads the limit query parameter, returning fallback when it is
+// absent. An explicit limit must be a number in 1..maxPageSize.
+func queryLimit(c *gin.Context, fallback int) (int, error) {
+	l, ok := c.GetQuery("limit")
+	if !ok {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit <= 0 {
+		return 0, errInvalidLimit
+	}
+	return checkLimit(limit, fallback)
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.Offset < 0 {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		want    pageCursor
+		wantErr bool
+	}{
+		{"offset", encodeCursor(pageCursor{Offset: 20}), pageCursor{Offset: 20}, false},
+		{"after", encodeCursor(pageCursor{After: "abc"}), pageCursor{After: "abc"}, false},
+		{"not base64", "not a cursor!", pageCursor{}, true},
+		{"not JSON", "bm90IGpzb24", pageCursor{}, true},
+		{"negative offset", encodeCursor(pageCursor{Offset: -1}), pageCursor{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"", 5, false},
+		{"?limit=1", 1, false},
+		{"?limit=100", 100, false},
+		{"?limit=", 0, true},
+		{"?limit=0", 0, true},
+		{"?limit=-3", 0, true},
+		{"?limit=101", 0, true},
+		{"?limit=ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/products"+tt.query, nil)
+		got, err := queryLimit(c, 5)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("queryLimit(%q) = %d, %v, want %d", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestCheckLimit(t *testing.T) {
+	tests := []struct {
+		limit   int
+		want    int
+		wantErr bool
+	}{
+		{0, 10, false},
+		{1, 1, false},
+		{maxPageSize, maxPageSize, false},
+		{-1, 0, true},
+		{maxPageSize + 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := checkLimit(tt.limit, 10)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("checkLimit(%d) = %d, %v, want %d", tt.limit, got, err, tt.want)
+		}
+	}
+}
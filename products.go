@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProductInput is the body accepted by POST and PUT /products.
+type ProductInput struct {
+	SKU         string   `json:"sku"`
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Brand       string   `json:"brand"`
+	Price       *float64 `json:"price"`
+	Currency    string   `json:"currency"`
+	InStock     *bool    `json:"in_stock"`
+	URL         string   `json:"url"`
+	ImageURL    string   `json:"image_url"`
+	Tags        []string `json:"tags"`
+	// Specs override the specs extracted from the name and description.
+	Specs map[string]interface{} `json:"specs"`
+}
+
+// ProductPatch is the body accepted by PATCH /products/:id. Only fields that
+// are present are changed.
+type ProductPatch struct {
+	SKU         *string `json:"sku"`
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Category    *string `json:"category"`
+	Brand       *string `json:"brand"`
+	// Price, InStock and Tags are cleared by a null.
+	Price    nullable[float64]  `json:"price"`
+	Currency *string            `json:"currency"`
+	InStock  nullable[bool]     `json:"in_stock"`
+	URL      *string            `json:"url"`
+	ImageURL *string            `json:"image_url"`
+	Tags     nullable[[]string] `json:"tags"`
+	// Specs are merged into the product's specs; a null value removes one.
+	Specs map[string]interface{} `json:"specs"`
+}
+
+// nullable is a patch field that tells a missing field from an explicit
+// null: Set reports whether the field was present and Value is nil for null.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	n.Value = nil
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, &n.Value)
+}
+
+// productFromInput builds a product, categorizing it and inferring its brand
+// when the caller did not give them.
+func productFromInput(ctx context.Context, id string, input ProductInput) (Product, error) {
+	product := Product{
+		ID:          id,
+		SKU:         strings.TrimSpace(input.SKU),
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		Category:    strings.TrimSpace(input.Category),
+		Brand:       input.Brand,
+		Price:       input.Price,
+		Currency:    input.Currency,
+		InStock:     input.InStock,
+		URL:         input.URL,
+		ImageURL:    input.ImageURL,
+		Tags:        input.Tags,
+	}
+	// binding:"required" only rejects a missing name, not a blank one.
+	if product.Name == "" {
+		return Product{}, errors.New("name cannot be empty")
+	}
+	if product.Category == "" {
+		product.Category = categorizeProduct(ctx, product).Category
+	}
+	if product.Brand == "" {
+		product.Brand = brandFromName(product.Name)
+	}
+	specs, err := coerceSpecs(input.Specs)
+	if err != nil {
+		return Product{}, err
+	}
+	product.Specs = specs
+	applySpecs(&product)
+	return product, normalizeProduct(&product)
+}
+
+// coerceSpecs validates specs supplied by a client.
+func coerceSpecs(raw map[string]interface{}) (map[string]interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	specs := map[string]interface{}{}
+	for name, value := range raw {
+		def, ok := findSpec(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown spec %q", name)
+		}
+		coerced, err := coerceSpec(def, value)
+		if err != nil {
+			return nil, err
+		}
+		specs[def.Name] = coerced
+	}
+	return specs, nil
+}
+
+// normalizeProduct tidies the optional catalog fields and rejects values the
+// storefront could not use.
+func normalizeProduct(p *Product) error {
+	p.Brand = strings.TrimSpace(p.Brand)
+	p.URL = strings.TrimSpace(p.URL)
+	p.ImageURL = strings.TrimSpace(p.ImageURL)
+
+	p.Currency = strings.ToUpper(strings.TrimSpace(p.Currency))
+	if p.Currency != "" && !isCurrencyCode(p.Currency) {
+		return fmt.Errorf("currency %q is not a three-letter ISO 4217 code", p.Currency)
+	}
+	if p.Price != nil && (*p.Price < 0 || math.IsNaN(*p.Price) || math.IsInf(*p.Price, 0)) {
+		return errors.New("price must be a non-negative number")
+	}
+	if err := checkURL("url", p.URL); err != nil {
+		return err
+	}
+	if err := checkURL("image_url", p.ImageURL); err != nil {
+		return err
+	}
+
+	// Tags are matched exactly by filters, so they are lower-cased and
+	// deduplicated.
+	tags := []string{}
+	for _, tag := range p.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	p.Tags = nil
+	if len(tags) > 0 {
+		p.Tags = tags
+	}
+	return nil
+}
+
+func checkURL(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s must be an absolute http(s) URL", field)
+	}
+	return nil
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func createProduct(c *gin.Context) {
+	var input ProductInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := productFromInput(c.Request.Context(), "", input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	product.ID = productID(product)
+
+	// IDs are derived from the SKU or name, so an existing ID means the
+	// product is already in the catalog.
+	if _, err := store.Get(c.Request.Context(), product.ID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": errProductExists.Error(), "id": product.ID})
+		return
+	} else if !errors.Is(err, errNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := upsertProduct(c.Request.Context(), &product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+func getProduct(c *gin.Context) {
+	product, err := store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+func replaceProduct(c *gin.Context) {
+	id := c.Param("id")
+
+	var input ProductInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := productFromInput(c.Request.Context(), id, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stored, err := store.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := saveEditedProduct(c.Request.Context(), &product, stored); err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error(), "id": product.ID})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+func patchProduct(c *gin.Context) {
+	var patch ProductPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stored, err := store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	product := stored
+
+	if patch.SKU != nil {
+		product.SKU = strings.TrimSpace(*patch.SKU)
+	}
+	if patch.Name != nil {
+		if strings.TrimSpace(*patch.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		product.Name = strings.TrimSpace(*patch.Name)
+	}
+	if patch.Description != nil {
+		product.Description = strings.TrimSpace(*patch.Description)
+	}
+	if patch.Category != nil {
+		product.Category = strings.TrimSpace(*patch.Category)
+		if product.Category == "" {
+			product.Category = categorizeProduct(c.Request.Context(), product).Category
+		}
+	}
+	if patch.Brand != nil {
+		product.Brand = *patch.Brand
+	}
+	if patch.Price.Set {
+		product.Price = patch.Price.Value
+	}
+	if patch.Currency != nil {
+		product.Currency = *patch.Currency
+	}
+	if patch.InStock.Set {
+		product.InStock = patch.InStock.Value
+	}
+	if patch.URL != nil {
+		product.URL = *patch.URL
+	}
+	if patch.ImageURL != nil {
+		product.ImageURL = *patch.ImageURL
+	}
+	if patch.Tags.Set {
+		product.Tags = nil
+		if patch.Tags.Value != nil {
+			product.Tags = *patch.Tags.Value
+		}
+	}
+	if patch.Name != nil || patch.Description != nil {
+		// Specs that came from the old text may no longer hold, so they are
+		// extracted again. Specs to keep can be sent in the same patch.
+		product.Specs = nil
+		applySpecs(&product)
+	}
+	for name, value := range patch.Specs {
+		def, ok := findSpec(name)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown spec %q", name)})
+			return
+		}
+		if value == nil {
+			delete(product.Specs, name)
+			continue
+		}
+		coerced, err := coerceSpec(def, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if product.Specs == nil {
+			product.Specs = map[string]interface{}{}
+		}
+		product.Specs[name] = coerced
+	}
+	// The product no longer matches its catalog record, so the next sync
+	// writes the record again.
+	product.SourceHash = ""
+	if err := normalizeProduct(&product); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := saveEditedProduct(c.Request.Context(), &product, stored); err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error(), "id": product.ID})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// saveEditedProduct writes product, an edit of stored. A product keyed by
+// its SKU or name moves to the ID derived from the edited values, so creates
+// and catalog syncs keep finding it; one with an explicit ID keeps it. Moving
+// onto the ID of another product fails with errProductExists.
+func saveEditedProduct(ctx context.Context, product *Product, stored Product) error {
+	product.ID = stored.ID
+	if stored.ID == productID(stored) {
+		product.ID = productID(*product)
+	}
+	if product.ID == stored.ID {
+		return upsertProduct(ctx, product)
+	}
+
+	if _, err := store.Get(ctx, product.ID); err == nil {
+		return errProductExists
+	} else if !errors.Is(err, errNotFound) {
+		return err
+	}
+	// Nothing is stored under the new ID yet, so the timestamps are carried
+	// over here rather than by upsertProduct.
+	product.CreatedAt = stored.CreatedAt
+	product.UpdatedAt = nil
+	if err := upsertProduct(ctx, product); err != nil {
+		return err
+	}
+	return store.Delete(ctx, stored.ID)
+}
+
+func deleteProduct(c *gin.Context) {
+	if err := store.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func listProducts(c *gin.Context) {
+	limit, err := queryLimit(c, 20)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := ListOptions{Limit: limit}
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			opts.Offset = parsed
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		if err != nil || decoded.After == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidCursor.Error()})
+			return
+		}
+		opts.After = decoded.After
+	}
+
+	products, err := store.List(c.Request.Context(), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	total, err := store.Count(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := SearchResponse{
+		Products: products,
+		Count:    len(products),
+		Total:    total,
+	}
+	if len(products) == limit {
+		response.NextCursor = encodeCursor(pageCursor{After: products[len(products)-1].ID})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errProductExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
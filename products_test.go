@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newProductRouter serves the product endpoints the way main does.
+func newProductRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/products", listProducts)
+	r.POST("/products", createProduct)
+	r.GET("/products/:id", getProduct)
+	r.PUT("/products/:id", replaceProduct)
+	r.PATCH("/products/:id", patchProduct)
+	r.DELETE("/products/:id", deleteProduct)
+	return r
+}
+
+func serve(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeProduct(t *testing.T, w *httptest.ResponseRecorder) Product {
+	t.Helper()
+	var p Product
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	return p
+}
+
+func TestProductCRUD(t *testing.T) {
+	useMemoryStore(t)
+	r := newProductRouter()
+
+	w := serve(r, http.MethodPost, "/products", `{"name": " Dell XPS 13 ", "description": "Laptop", "category": "laptops"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	created := decodeProduct(t, w)
+	if created.ID == "" || created.Name != "Dell XPS 13" || created.CreatedAt == nil || created.UpdatedAt == nil {
+		t.Fatalf("create returned %+v", created)
+	}
+	path := "/products/" + created.ID
+
+	// The steps run in order against the same product.
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		// want checks the returned product when the request succeeds.
+		want func(p Product) bool
+	}{
+		{"get", http.MethodGet, path, "", http.StatusOK, func(p Product) bool { return p.Name == "Dell XPS 13" && p.Category == "laptops" }},
+		{"get unknown", http.MethodGet, "/products/missing", "", http.StatusNotFound, nil},
+		{"create duplicate", http.MethodPost, "/products", `{"name": "dell  xps 13"}`, http.StatusConflict, nil},
+		{"create without name", http.MethodPost, "/products", `{"description": "No name"}`, http.StatusBadRequest, nil},
+		{"create blank name", http.MethodPost, "/products", `{"name": "   "}`, http.StatusBadRequest, nil},
+		{"create invalid JSON", http.MethodPost, "/products", `{"name": `, http.StatusBadRequest, nil},
+		{"replace", http.MethodPut, path, `{"name": "Dell XPS 13", "description": "Compact laptop", "category": "laptops"}`, http.StatusOK, func(p Product) bool {
+			return p.ID == created.ID && p.Description == "Compact laptop"
+		}},
+		{"replace blank name", http.MethodPut, path, `{"name": " ", "description": "Compact laptop"}`, http.StatusBadRequest, nil},
+		{"replace unknown", http.MethodPut, "/products/missing", `{"name": "Other"}`, http.StatusNotFound, nil},
+		{"patch description", http.MethodPatch, path, `{"description": "Patched"}`, http.StatusOK, func(p Product) bool {
+			return p.Name == "Dell XPS 13" && p.Description == "Patched" && p.Category == "laptops"
+		}},
+		{"patch price and tags", http.MethodPatch, path, `{"price": 1199.5, "currency": "eur", "tags": [" Travel ", "travel", "Ultrabook"]}`, http.StatusOK, func(p Product) bool {
+			return p.Price != nil && *p.Price == 1199.5 && p.Currency == "EUR" && reflect.DeepEqual(p.Tags, []string{"travel", "ultrabook"}) && p.Description == "Patched"
+		}},
+		{"patch in stock", http.MethodPatch, path, `{"in_stock": true}`, http.StatusOK, func(p Product) bool {
+			return p.InStock != nil && *p.InStock && p.Price != nil && len(p.Tags) == 2
+		}},
+		{"patch null clears price, stock and tags", http.MethodPatch, path, `{"price": null, "in_stock": null, "tags": null}`, http.StatusOK, func(p Product) bool {
+			return p.Price == nil && p.InStock == nil && len(p.Tags) == 0 && p.Currency == "EUR"
+		}},
+		{"patch price of the wrong type", http.MethodPatch, path, `{"price": "cheap"}`, http.StatusBadRequest, nil},
+		{"patch spec", http.MethodPatch, path, `{"specs": {"ram_gb": "16"}}`, http.StatusOK, func(p Product) bool { return p.Specs["ram_gb"] == 16.0 }},
+		{"patch null spec removes it", http.MethodPatch, path, `{"specs": {"ram_gb": null}}`, http.StatusOK, func(p Product) bool { return p.Specs["ram_gb"] == nil }},
+		{"patch unknown spec", http.MethodPatch, path, `{"specs": {"colour": "red"}}`, http.StatusBadRequest, nil},
+		{"patch invalid currency", http.MethodPatch, path, `{"currency": "euro"}`, http.StatusBadRequest, nil},
+		{"patch relative URL", http.MethodPatch, path, `{"url": "/dell-xps-13"}`, http.StatusBadRequest, nil},
+		{"create negative price", http.MethodPost, "/products", `{"name": "Refund", "price": -1}`, http.StatusBadRequest, nil},
+		{"patch blank name", http.MethodPatch, path, `{"name": "  "}`, http.StatusBadRequest, nil},
+		{"get after patch", http.MethodGet, path, "", http.StatusOK, func(p Product) bool { return p.Description == "Patched" }},
+		{"list", http.MethodGet, "/products", "", http.StatusOK, nil},
+		{"delete", http.MethodDelete, path, "", http.StatusNoContent, nil},
+		{"get deleted", http.MethodGet, path, "", http.StatusNotFound, nil},
+		{"delete again", http.MethodDelete, path, "", http.StatusNotFound, nil},
+	}
+
+	for _, step := range steps {
+		w := serve(r, step.method, step.path, step.body)
+		if w.Code != step.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body)
+			continue
+		}
+		if step.want != nil {
+			if p := decodeProduct(t, w); !step.want(p) {
+				t.Errorf("%s: got %+v", step.name, p)
+			}
+		}
+	}
+}
+
+func TestProductRename(t *testing.T) {
+	explicit := Product{ID: "5d9c3a4e-1f3b-4c8e-9a2d-7b6e5f4a3c21", Name: "Steam Deck", Category: "gaming"}
+	s := useMemoryStore(t,
+		Product{Name: "Dell XPS 13", Category: "laptops", CreatedAt: timePtr("2024-01-02T00:00:00Z")},
+		Product{Name: "MacBook Air", Category: "laptops"},
+		explicit,
+	)
+	r := newProductRouter()
+	ctx := context.Background()
+	dell := productID(Product{Name: "Dell XPS 13"})
+	original, err := s.Get(ctx, dell)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		// wantID is the ID the product is stored under afterwards.
+		wantID string
+	}{
+		{"rename onto another product", http.MethodPatch, "/products/" + dell, `{"name": "MacBook Air"}`, http.StatusConflict, dell},
+		{"rename", http.MethodPatch, "/products/" + dell, `{"name": "Dell XPS 13 Plus"}`, http.StatusOK, productID(Product{Name: "Dell XPS 13 Plus"})},
+		{"new SKU", http.MethodPut, "/products/" + productID(Product{Name: "Dell XPS 13 Plus"}), `{"sku": "XPS-9320", "name": "Dell XPS 13 Plus", "category": "laptops"}`, http.StatusOK, productID(Product{SKU: "XPS-9320"})},
+		{"case-only rename keeps the ID", http.MethodPatch, "/products/" + productID(Product{SKU: "XPS-9320"}), `{"sku": "xps-9320"}`, http.StatusOK, productID(Product{SKU: "XPS-9320"})},
+		{"explicit ID is kept", http.MethodPatch, "/products/" + explicit.ID, `{"name": "Steam Deck OLED"}`, http.StatusOK, explicit.ID},
+	}
+
+	for _, step := range steps {
+		before, _ := s.Count(ctx, nil)
+		w := serve(r, step.method, step.path, step.body)
+		if w.Code != step.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body)
+			continue
+		}
+		if after, _ := s.Count(ctx, nil); after != before {
+			t.Errorf("%s: %d products afterwards, want %d", step.name, after, before)
+		}
+		if _, err := s.Get(ctx, step.wantID); err != nil {
+			t.Errorf("%s: nothing stored under %s: %v", step.name, step.wantID, err)
+		}
+		if w.Code == http.StatusOK {
+			if p := decodeProduct(t, w); p.ID != step.wantID {
+				t.Errorf("%s: returned ID %s, want %s", step.name, p.ID, step.wantID)
+			}
+		}
+	}
+
+	moved, err := s.Get(ctx, productID(Product{SKU: "XPS-9320"}))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if moved.CreatedAt == nil || !moved.CreatedAt.Equal(*original.CreatedAt) {
+		t.Errorf("created at %v, want the original %v", moved.CreatedAt, original.CreatedAt)
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	useMemoryStore(t,
+		Product{ID: "1", Name: "One"},
+		Product{ID: "2", Name: "Two"},
+		Product{ID: "3", Name: "Three"},
+	)
+	r := newProductRouter()
+
+	tests := []struct {
+		query string
+		want  []string
+		// next is whether a next page cursor is returned.
+		next bool
+	}{
+		{"", []string{"One", "Two", "Three"}, false},
+		{"?limit=2", []string{"One", "Two"}, true},
+		{"?limit=2&offset=2", []string{"Three"}, false},
+		{"?offset=5", []string{}, false},
+		{"?limit=1&cursor=" + encodeCursor(pageCursor{After: "1"}), []string{"Two"}, true},
+		{"?cursor=" + encodeCursor(pageCursor{After: "2"}), []string{"Three"}, false},
+	}
+
+	for _, tt := range tests {
+		w := serve(r, http.MethodGet, "/products"+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", tt.query, w.Code, w.Body)
+			continue
+		}
+		var response SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got := productNames(response.Products); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+		if response.Total != 3 {
+			t.Errorf("%s: total %d, want 3", tt.query, response.Total)
+		}
+		if (response.NextCursor != "") != tt.next {
+			t.Errorf("%s: next cursor %q, want one: %t", tt.query, response.NextCursor, tt.next)
+		}
+	}
+
+	for _, limit := range []string{"0", "-1", "101", "ten"} {
+		if w := serve(r, http.MethodGet, "/products?limit="+limit, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("limit %q: status %d, want 400", limit, w.Code)
+		}
+	}
+	for _, cursor := range []string{"bad", encodeCursor(pageCursor{Offset: 2})} {
+		if w := serve(r, http.MethodGet, "/products?cursor="+cursor, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("cursor %q: status %d, want 400", cursor, w.Code)
+		}
+	}
+}
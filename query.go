@@ -0,0 +1,321 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// QueryInterpretation is what the search understood from a free-text query.
+// Price and brand phrases are turned into filters and removed from the query;
+// Text is what is actually searched.
+type QueryInterpretation struct {
+	Original string   `json:"original"`
+	Text     string   `json:"text"`
+	MinPrice *float64 `json:"min_price,omitempty"`
+	MaxPrice *float64 `json:"max_price,omitempty"`
+	Brand    string   `json:"brand,omitempty"`
+	Category string   `json:"category,omitempty"`
+}
+
+// pricePattern matches an amount such as "$300", "1,299.99", "1.5k" or
+// "300 dollars". Its four groups are the currency symbol, the number, the
+// thousands suffix and the currency word.
+const pricePattern = `([$€£]\s?)?(\d[\d,]*(?:\.\d+)?)(k\b)?(\s?(?:dollars|bucks|usd|euros?|eur|gbp)\b)?`
+
+type priceRule struct {
+	re *regexp.Regexp
+	// kind is "range", "max", "min" or "around".
+	kind string
+	// needsCurrency rejects bare numbers, which are too easily a quantity
+	// ("2-3 players") when there is no price word in front of them.
+	needsCurrency bool
+}
+
+func newPriceRule(kind, pattern string, needsCurrency bool) priceRule {
+	pattern = "(?i)" + strings.ReplaceAll(pattern, "{price}", pricePattern)
+	return priceRule{re: regexp.MustCompile(pattern), kind: kind, needsCurrency: needsCurrency}
+}
+
+// priceRules are tried in order; ranges come first so "between $100 and $200"
+// is not read as a lower bound alone.
+var priceRules = []priceRule{
+	newPriceRule("range", `\b(?:between|from)\s+{price}\s*(?:and|to|-)\s*{price}`, false),
+	newPriceRule("range", `{price}\s*(?:-|to)\s*{price}`, true),
+	newPriceRule("max", `\b(?:under|below|less than|cheaper than|no more than|at most|max(?:imum)?|up to|within|budget(?: of)?)\s+{price}`, false),
+	newPriceRule("max", `{price}\s+(?:or|and) (?:less|under|below)\b`, true),
+	newPriceRule("max", `<=?\s*{price}`, false),
+	newPriceRule("min", `\b(?:over|above|more than|at least|min(?:imum)?|starting (?:at|from))\s+{price}`, false),
+	newPriceRule("min", `{price}\s*(?:\+|(?:and|or) (?:up|more|above|over)\b)`, true),
+	newPriceRule("min", `>=?\s*{price}`, false),
+	newPriceRule("around", `(?:\b(?:around|about|approximately|roughly)\s+|~\s*){price}`, false),
+}
+
+// unitPattern follows numbers that are not prices, as in "under 14 inches".
+var unitPattern = regexp.MustCompile(`(?i)^\s?(?:inch(?:es)?\b|in\b|"|[gmt]b\b|mp\b|megapixels?\b|hours?\b|hrs?\b|h\b|mah\b|w\b|watts?\b|hz\b|kg\b|g\b|lbs?\b|pounds?\b|oz\b|mm\b|cm\b|m\b|x\b|players?\b|people\b|years?\b|months?\b|days?\b|minutes?\b|mins?\b|%)`)
+
+// aroundSpread is how far an "around $300" price may stray either way.
+const aroundSpread = 0.2
+
+type categoryHint struct {
+	re       *regexp.Regexp
+	category string
+}
+
+// categorySynonyms are query words for a category besides its own name.
+// Categories missing from the taxonomy are ignored.
+var categorySynonyms = map[string][]string{
+	"smartphones":  {`smart ?phones?`, `phones?`, `mobiles?`},
+	"laptops":      {`notebooks?`},
+	"headphones":   {`headsets?`},
+	"earbuds":      {`earphones?`},
+	"speakers":     {`soundbars?`},
+	"smartwatches": {`smart ?watch(?:es)?`, `watch(?:es)?`},
+	"e-readers":    {`ebook readers?`},
+	"gaming":       {`consoles?`},
+	"kitchen":      {`mixers?`, `blenders?`},
+	"fitness":      {`fitness equipment`, `exercise bikes?`, `treadmills?`},
+	"automotive":   {`cars?`},
+	"accessories":  {`cases?`, `chargers?`, `cables?`, `adapters?`},
+}
+
+var (
+	categoryHintsOnce sync.Once
+	categoryHintList  []categoryHint
+)
+
+// categoryHints map words in a query to a category: every taxonomy category
+// is hinted at by its own name and its synonyms. They are built on first use,
+// after TAXONOMY_FILE has been loaded.
+func categoryHints() []categoryHint {
+	categoryHintsOnce.Do(func() {
+		for _, category := range taxonomy.names {
+			words := append([]string{categoryNamePattern(category)}, categorySynonyms[category]...)
+			categoryHintList = append(categoryHintList, categoryHint{
+				re:       regexp.MustCompile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`),
+				category: category,
+			})
+		}
+	})
+	return categoryHintList
+}
+
+// categoryNamePattern matches a category name as written in a query, with
+// or without its hyphens and plural.
+func categoryNamePattern(name string) string {
+	stem, plural := name, `s?`
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		stem, plural = strings.TrimSuffix(name, "ies"), `(?:y|ies)`
+	case strings.HasSuffix(name, "s"):
+		stem = strings.TrimSuffix(name, "s")
+	}
+	return strings.ReplaceAll(regexp.QuoteMeta(stem), "-", `[\s-]?`) + plural
+}
+
+// hintedCategory picks the category the hints in text point at. Words inside
+// a longer hint ("fitness" in "fitness tracker") are skipped, and among
+// related categories the most specific wins. Hints at unrelated categories,
+// as in "gaming laptop" or "phone case", are left to the vector search.
+func hintedCategory(text string) string {
+	type hintMatch struct {
+		start, end int
+		category   string
+	}
+	var matches []hintMatch
+	for _, hint := range categoryHints() {
+		for _, m := range hint.re.FindAllStringIndex(text, -1) {
+			matches = append(matches, hintMatch{m[0], m[1], hint.category})
+		}
+	}
+
+	category := ""
+	for _, m := range matches {
+		inside := false
+		for _, other := range matches {
+			if other.start <= m.start && m.end <= other.end && other.end-other.start > m.end-m.start {
+				inside = true
+				break
+			}
+		}
+		switch {
+		case inside || m.category == category:
+		case category == "" || taxonomy.related(m.category, category) && len(taxonomy.path(m.category)) > len(taxonomy.path(category)):
+			category = m.category
+		case !taxonomy.related(m.category, category):
+			return ""
+		}
+	}
+	return category
+}
+
+var (
+	brandPatternsOnce sync.Once
+	brandPatterns     map[string]*regexp.Regexp
+)
+
+// brandPattern matches a brand, together with a leading "by" or "from".
+func brandPattern(brand string) *regexp.Regexp {
+	brandPatternsOnce.Do(func() {
+		brandPatterns = map[string]*regexp.Regexp{}
+		for _, known := range brands() {
+			brandPatterns[known] = regexp.MustCompile(`(?i)(?:\b(?:made by|by|from)\s+)?\b` + regexp.QuoteMeta(known) + `\b`)
+		}
+	})
+	return brandPatterns[brand]
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// parseQuery splits a free-text query into the text to search and the price,
+// brand and category constraints it mentions.
+func parseQuery(query string) QueryInterpretation {
+	interp := QueryInterpretation{Original: query}
+	text := query
+
+	for _, rule := range priceRules {
+		if boundTaken(interp, rule.kind) {
+			continue
+		}
+		for _, m := range rule.re.FindAllStringSubmatchIndex(text, -1) {
+			prices, ok := matchPrices(text, m, rule.needsCurrency)
+			if !ok {
+				continue
+			}
+			switch rule.kind {
+			case "range":
+				low, high := math.Min(prices[0], prices[1]), math.Max(prices[0], prices[1])
+				interp.MinPrice, interp.MaxPrice = &low, &high
+			case "max":
+				interp.MaxPrice = &prices[0]
+			case "min":
+				interp.MinPrice = &prices[0]
+			case "around":
+				low := roundCents(prices[0] * (1 - aroundSpread))
+				high := roundCents(prices[0] * (1 + aroundSpread))
+				interp.MinPrice, interp.MaxPrice = &low, &high
+			}
+			text = text[:m[0]] + " " + text[m[1]:]
+			break
+		}
+	}
+
+	// A brand is only applied when exactly one is mentioned; "sony or bose"
+	// is left to the vector search.
+	var found []string
+	for _, brand := range brands() {
+		if brandPattern(brand).MatchString(text) {
+			found = append(found, brand)
+		}
+	}
+	if len(found) == 1 {
+		interp.Brand = found[0]
+		text = brandPattern(found[0]).ReplaceAllString(text, " ")
+	}
+
+	// Category words describe what the user wants, so unlike price and
+	// brand phrases they stay in the searched text.
+	interp.Category = hintedCategory(text)
+
+	interp.Text = strings.TrimSpace(spaces.ReplaceAllString(text, " "))
+	return interp
+}
+
+// boundTaken reports whether an earlier rule already set the bounds a rule of
+// this kind would set.
+func boundTaken(interp QueryInterpretation, kind string) bool {
+	switch kind {
+	case "max":
+		return interp.MaxPrice != nil
+	case "min":
+		return interp.MinPrice != nil
+	}
+	return interp.MinPrice != nil || interp.MaxPrice != nil
+}
+
+// matchPrices reads the amounts captured by a price rule match m. Amounts
+// followed by a unit, or without a currency when one is required, are not
+// prices.
+func matchPrices(text string, m []int, needsCurrency bool) ([]float64, bool) {
+	var prices []float64
+	hasCurrency := false
+	// Submatch pairs start at index 2; each amount has four groups.
+	for g := 2; g+8 <= len(m); g += 8 {
+		symbol, number, thousands, word := m[g], m[g+2], m[g+4], m[g+6]
+		if symbol >= 0 || word >= 0 {
+			hasCurrency = true
+		}
+		end := m[g+3]
+		if thousands >= 0 {
+			end = m[g+5]
+		}
+		if word < 0 && unitPattern.MatchString(text[end:]) {
+			return nil, false
+		}
+		value, err := strconv.ParseFloat(strings.ReplaceAll(text[number:m[g+3]], ",", ""), 64)
+		if err != nil {
+			return nil, false
+		}
+		if thousands >= 0 {
+			value *= 1000
+		}
+		prices = append(prices, value)
+	}
+	if len(prices) == 0 || (needsCurrency && !hasCurrency) {
+		return nil, false
+	}
+	return prices, true
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// applyTo merges the interpreted constraints into filters. Constraints the
+// caller already filters on are left out, and dropped from the
+// interpretation so it shows what was applied.
+func (q *QueryInterpretation) applyTo(filters *SearchFilters) *SearchFilters {
+	merged := SearchFilters{}
+	if filters != nil {
+		merged = *filters
+		merged.Properties = append([]PropertyFilter(nil), filters.Properties...)
+	}
+
+	if q.MinPrice != nil || q.MaxPrice != nil {
+		if hasPropertyFilter(merged.Properties, "price") {
+			q.MinPrice, q.MaxPrice = nil, nil
+		} else {
+			merged.Properties = append(merged.Properties, PropertyFilter{Property: "price", Operator: "range", Min: q.MinPrice, Max: q.MaxPrice})
+		}
+	}
+	if q.Brand != "" {
+		if hasPropertyFilter(merged.Properties, "brand") {
+			q.Brand = ""
+		} else {
+			merged.Properties = append(merged.Properties, PropertyFilter{Property: "brand", Operator: "equals", Value: q.Brand})
+		}
+	}
+	if q.Category != "" {
+		if merged.Category != "" || len(merged.Categories) > 0 {
+			q.Category = ""
+		} else {
+			merged.Category = q.Category
+		}
+	}
+
+	if merged.isEmpty() {
+		return nil
+	}
+	return &merged
+}
+
+func hasPropertyFilter(filters []PropertyFilter, property string) bool {
+	for _, pf := range filters {
+		if pf.Property == property {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  QueryInterpretation
+	}{
+		{"noise cancelling headphones under $300", QueryInterpretation{Text: "noise cancelling headphones", MaxPrice: float64Ptr(300), Category: "headphones"}},
+		{"laptop between $800 and $1,200", QueryInterpretation{Text: "laptop", MinPrice: float64Ptr(800), MaxPrice: float64Ptr(1200), Category: "laptops"}},
+		{"sony headphones $400-$200", QueryInterpretation{Text: "headphones", MinPrice: float64Ptr(200), MaxPrice: float64Ptr(400), Brand: "Sony", Category: "headphones"}},
+		{"camera around $500", QueryInterpretation{Text: "camera", MinPrice: float64Ptr(400), MaxPrice: float64Ptr(600), Category: "cameras"}},
+		{"tablet $1.5k or less", QueryInterpretation{Text: "tablet", MaxPrice: float64Ptr(1500), Category: "tablets"}},
+		{"ipad over 500 dollars", QueryInterpretation{Text: "ipad", MinPrice: float64Ptr(500)}},
+		{"speaker $50+", QueryInterpretation{Text: "speaker", MinPrice: float64Ptr(50), Category: "speakers"}},
+		{"headphones from Bose", QueryInterpretation{Text: "headphones", Brand: "Bose", Category: "headphones"}},
+
+		// Numbers with units and bare ranges are not prices.
+		{"laptop under 14 inches", QueryInterpretation{Text: "laptop under 14 inches", Category: "laptops"}},
+		{"2-3 players board game", QueryInterpretation{Text: "2-3 players board game"}},
+		{"phone with 5000 mAh battery", QueryInterpretation{Text: "phone with 5000 mAh battery", Category: "smartphones"}},
+
+		// Two brands, or categories on different branches, are left to
+		// the search.
+		{"sony or bose headphones", QueryInterpretation{Text: "sony or bose headphones", Category: "headphones"}},
+		{"gaming laptop", QueryInterpretation{Text: "gaming laptop"}},
+		{"phone case", QueryInterpretation{Text: "phone case"}},
+
+		// Related categories resolve to the most specific one, and words
+		// inside a longer category name do not count on their own.
+		{"wearable smart watch", QueryInterpretation{Text: "wearable smart watch", Category: "smartwatches"}},
+		{"fitness tracker", QueryInterpretation{Text: "fitness tracker", Category: "fitness-trackers"}},
+		{"smart home hub", QueryInterpretation{Text: "smart home hub", Category: "smart-home"}},
+		{"e-reader", QueryInterpretation{Text: "e-reader", Category: "e-readers"}},
+
+		{"under $50", QueryInterpretation{Text: "", MaxPrice: float64Ptr(50)}},
+		{"", QueryInterpretation{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			tt.want.Original = tt.query
+			got := parseQuery(tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseQuery(%q) = %s, want %s", tt.query, describeInterpretation(got), describeInterpretation(tt.want))
+			}
+		})
+	}
+}
+
+func TestApplyInterpretation(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		filters *SearchFilters
+		// want are the merged filters; kept is what stays in the
+		// interpretation.
+		want *SearchFilters
+		kept QueryInterpretation
+	}{
+		{
+			name:  "adds interpreted filters",
+			query: "sony headphones under $300",
+			want: &SearchFilters{Category: "headphones", Properties: []PropertyFilter{
+				{Property: "price", Operator: "range", Max: float64Ptr(300)},
+				{Property: "brand", Operator: "equals", Value: "Sony"},
+			}},
+			kept: QueryInterpretation{Text: "headphones", MaxPrice: float64Ptr(300), Brand: "Sony", Category: "headphones"},
+		},
+		{
+			name:  "request filters win",
+			query: "sony headphones under $300",
+			filters: &SearchFilters{Category: "audio", Properties: []PropertyFilter{
+				{Property: "price", Operator: "range", Min: float64Ptr(100)},
+			}},
+			want: &SearchFilters{Category: "audio", Properties: []PropertyFilter{
+				{Property: "price", Operator: "range", Min: float64Ptr(100)},
+				{Property: "brand", Operator: "equals", Value: "Sony"},
+			}},
+			kept: QueryInterpretation{Text: "headphones", Brand: "Sony"},
+		},
+		{
+			name:  "nothing interpreted",
+			query: "something nice",
+			want:  nil,
+			kept:  QueryInterpretation{Text: "something nice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interp := parseQuery(tt.query)
+			got := interp.applyTo(tt.filters)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filters = %+v, want %+v", got, tt.want)
+			}
+			tt.kept.Original = tt.query
+			if !reflect.DeepEqual(interp, tt.kept) {
+				t.Errorf("interpretation = %s, want %s", describeInterpretation(interp), describeInterpretation(tt.kept))
+			}
+		})
+	}
+}
+
+func describeInterpretation(q QueryInterpretation) string {
+	bound := func(p *float64) string {
+		if p == nil {
+			return "-"
+		}
+		return fmt.Sprint(*p)
+	}
+	return fmt.Sprintf("{text: %q, min: %s, max: %s, brand: %q, category: %q}",
+		q.Text, bound(q.MinPrice), bound(q.MaxPrice), q.Brand, q.Category)
+}
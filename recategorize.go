@@ -0,0 +1,531 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Proposal statuses
+const (
+	proposalPending  = "pending"
+	proposalAccepted = "accepted"
+	proposalRejected = "rejected"
+	// proposalStale marks a proposal whose product changed before it was
+	// reviewed.
+	proposalStale = "stale"
+)
+
+var (
+	errRecategorizeRunning = errors.New("a recategorization is already running")
+	errProposalNotPending  = errors.New("proposal is not pending")
+	errProposalStale       = errors.New("product changed since the proposal was made; run recategorization again")
+)
+
+// RecategorizeRequest is the optional body of POST /categories/recategorize.
+type RecategorizeRequest struct {
+	// MinConfidence drops proposals the model is less sure of.
+	MinConfidence float64 `json:"min_confidence"`
+}
+
+// RecategorizeJob tracks one run of the LLM categorizer over the catalog.
+// It only proposes changes; nothing is written until a proposal is accepted.
+type RecategorizeJob struct {
+	jobState
+	MinConfidence float64 `json:"min_confidence"`
+	Processed     int     `json:"processed"`
+	// Cached counts products answered from the cache without calling the
+	// model.
+	Cached    int `json:"cached"`
+	Unchanged int `json:"unchanged"`
+	Proposed  int `json:"proposed"`
+	// LowConfidence counts changes below MinConfidence, which are not
+	// proposed.
+	LowConfidence int `json:"low_confidence"`
+	// Rejected counts changes a reviewer already rejected for the same
+	// content, which are not proposed again.
+	Rejected int           `json:"rejected"`
+	Failed   int           `json:"failed"`
+	Errors   []ObjectError `json:"errors"`
+}
+
+func (j *RecategorizeJob) clone() RecategorizeJob {
+	snapshot := *j
+	snapshot.Errors = append([]ObjectError{}, j.Errors...)
+	return snapshot
+}
+
+// recategorizeJobs runs one recategorization at a time.
+var recategorizeJobs = newJobRegistry[RecategorizeJob](true)
+
+// Meta keys of the review queue and the categorization cache.
+const (
+	reviewKeyPrefix = "category_review:"
+	cacheKeyPrefix  = "category_cache:"
+)
+
+// saveMeta stores value as JSON under key when the store keeps bookkeeping.
+// A failure is only logged: the in-memory state stays right until a restart.
+func saveMeta(ctx context.Context, key string, value interface{}) {
+	meta, ok := store.(metaStore)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = meta.setMeta(ctx, key, string(data))
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", key, err)
+	}
+}
+
+func deleteMeta(ctx context.Context, key string) {
+	meta, ok := store.(metaStore)
+	if !ok {
+		return
+	}
+	if err := meta.deleteMeta(ctx, key); err != nil {
+		log.Printf("Error deleting %s: %v", key, err)
+	}
+}
+
+// loadCategoryReviews restores the review queue and the categorization cache
+// saved in the meta class, if the store has one.
+func loadCategoryReviews(ctx context.Context) {
+	meta, ok := store.(metaStore)
+	if !ok {
+		return
+	}
+
+	reviews, err := meta.listMeta(ctx, reviewKeyPrefix)
+	if err != nil {
+		log.Printf("Error loading category reviews: %v", err)
+		return
+	}
+	for key, value := range reviews {
+		var p CategoryProposal
+		if err := json.Unmarshal([]byte(value), &p); err != nil {
+			log.Printf("Ignoring invalid %s: %v", key, err)
+			continue
+		}
+		categoryReviews.proposals[p.ProductID] = &p
+	}
+
+	cached, err := meta.listMeta(ctx, cacheKeyPrefix)
+	if err != nil {
+		log.Printf("Error loading categorization cache: %v", err)
+		return
+	}
+	for key, value := range cached {
+		var result Categorization
+		if err := json.Unmarshal([]byte(value), &result); err != nil {
+			log.Printf("Ignoring invalid %s: %v", key, err)
+			continue
+		}
+		recategorizeCache.results[strings.TrimPrefix(key, cacheKeyPrefix)] = result
+	}
+	log.Printf("Loaded %d category reviews and %d cached categorizations", len(reviews), len(cached))
+}
+
+// categorizationCache remembers the model's answer for a product's name and
+// description, which is all the model sees, so a rerun only pays for
+// products whose text changed.
+type categorizationCache struct {
+	mu      sync.Mutex
+	results map[string]Categorization
+}
+
+var recategorizeCache = &categorizationCache{results: map[string]Categorization{}}
+
+// categorizationKey hashes the text the categorizer is shown.
+func categorizationKey(p Product) string {
+	sum := sha256.Sum256([]byte(p.Name + "\x00" + p.Description))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the cached answer for key, unless the taxonomy no longer has
+// its category.
+func (c *categorizationCache) get(key string) (Categorization, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.results[key]
+	if ok && !containsString(productCategories, result.Category) {
+		return Categorization{}, false
+	}
+	return result, ok
+}
+
+func (c *categorizationCache) put(ctx context.Context, key string, result Categorization) {
+	c.mu.Lock()
+	c.results[key] = result
+	c.mu.Unlock()
+	saveMeta(ctx, cacheKeyPrefix+key, result)
+}
+
+// retain forgets every key not in keep, so edited and deleted products do
+// not accumulate.
+func (c *categorizationCache) retain(ctx context.Context, keep map[string]bool) {
+	c.mu.Lock()
+	stale := []string{}
+	for key := range c.results {
+		if !keep[key] {
+			delete(c.results, key)
+			stale = append(stale, key)
+		}
+	}
+	c.mu.Unlock()
+	for _, key := range stale {
+		deleteMeta(ctx, cacheKeyPrefix+key)
+	}
+}
+
+// CategoryProposal is a category change waiting for a merchandiser. There is
+// at most one per product.
+type CategoryProposal struct {
+	ProductID        string   `json:"product_id"`
+	ProductName      string   `json:"product_name"`
+	CurrentCategory  string   `json:"current_category"`
+	ProposedCategory string   `json:"proposed_category"`
+	ProposedPath     []string `json:"proposed_path"`
+	Confidence       float64  `json:"confidence"`
+	// ContentHash is the product's hash when the proposal was made; the
+	// proposal can only be accepted while the product still has it.
+	ContentHash string     `json:"content_hash"`
+	JobID       string     `json:"job_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// reviewQueue holds the proposals. Every change is saved to the meta class
+// while the lock is held, so saved states are never reordered.
+type reviewQueue struct {
+	mu        sync.Mutex
+	proposals map[string]*CategoryProposal
+}
+
+var categoryReviews = &reviewQueue{proposals: map[string]*CategoryProposal{}}
+
+// propose queues p unless it is already queued, or a reviewer rejected the
+// same change for the same content. It reports whether p is pending.
+func (q *reviewQueue) propose(ctx context.Context, p CategoryProposal) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if existing, ok := q.proposals[p.ProductID]; ok &&
+		existing.ContentHash == p.ContentHash && existing.ProposedCategory == p.ProposedCategory {
+		if existing.Status == proposalRejected {
+			return false
+		}
+		if existing.Status == proposalPending {
+			return true
+		}
+	}
+	p.Status = proposalPending
+	q.proposals[p.ProductID] = &p
+	saveMeta(ctx, reviewKeyPrefix+p.ProductID, p)
+	return true
+}
+
+// withdraw drops a pending proposal the model no longer makes.
+func (q *reviewQueue) withdraw(ctx context.Context, productID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if existing, ok := q.proposals[productID]; ok && existing.Status == proposalPending {
+		delete(q.proposals, productID)
+		deleteMeta(ctx, reviewKeyPrefix+productID)
+	}
+}
+
+// list returns the proposals with the given status, or all of them, oldest
+// first.
+func (q *reviewQueue) list(status string) []CategoryProposal {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	proposals := []CategoryProposal{}
+	for _, p := range q.proposals {
+		if status == "" || p.Status == status {
+			proposals = append(proposals, *p)
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		if !proposals[i].CreatedAt.Equal(proposals[j].CreatedAt) {
+			return proposals[i].CreatedAt.Before(proposals[j].CreatedAt)
+		}
+		return proposals[i].ProductID < proposals[j].ProductID
+	})
+	return proposals
+}
+
+// review moves a pending proposal to status. Only one caller can move a
+// given proposal, so concurrent reviews of it cannot both succeed.
+func (q *reviewQueue) review(ctx context.Context, productID, status string) (CategoryProposal, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	p, ok := q.proposals[productID]
+	if !ok {
+		return CategoryProposal{}, errNotFound
+	}
+	if p.Status != proposalPending {
+		return *p, errProposalNotPending
+	}
+	q.setStatus(ctx, p, status)
+	return *p, nil
+}
+
+// revise moves a proposal taken by review on to status, e.g. back to pending
+// when writing the product failed.
+func (q *reviewQueue) revise(ctx context.Context, productID, status string) CategoryProposal {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	p, ok := q.proposals[productID]
+	if !ok {
+		return CategoryProposal{}
+	}
+	q.setStatus(ctx, p, status)
+	return *p
+}
+
+// setStatus changes the status of p and saves it. Callers must hold the lock.
+func (q *reviewQueue) setStatus(ctx context.Context, p *CategoryProposal, status string) {
+	p.Status = status
+	p.ReviewedAt = nil
+	if status != proposalPending {
+		reviewed := time.Now().UTC()
+		p.ReviewedAt = &reviewed
+	}
+	saveMeta(ctx, reviewKeyPrefix+p.ProductID, p)
+}
+
+// runRecategorize pages through the catalog and asks the LLM categorizer
+// about every product, at most RECATEGORIZE_CONCURRENCY at a time.
+func runRecategorize(ctx context.Context, jobID string, minConfidence float64) error {
+	concurrency := getEnvInt("RECATEGORIZE_CONCURRENCY", 4)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var c Categorizer = llmCategorizer{}
+
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	after := ""
+	for {
+		page, err := store.List(ctx, ListOptions{Limit: syncPageSize, After: after})
+		if err != nil {
+			wg.Wait()
+			return err
+		}
+		for _, product := range page {
+			key := categorizationKey(product)
+			mu.Lock()
+			seen[key] = true
+			mu.Unlock()
+
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(product Product, key string) {
+				defer func() { <-sem; wg.Done() }()
+				recategorizeOne(ctx, jobID, c, product, key, minConfidence)
+			}(product, key)
+		}
+		if len(page) < syncPageSize {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	wg.Wait()
+
+	recategorizeCache.retain(ctx, seen)
+	return nil
+}
+
+func recategorizeOne(ctx context.Context, jobID string, c Categorizer, product Product, key string, minConfidence float64) {
+	result, cached := recategorizeCache.get(key)
+	if !cached {
+		var err error
+		result, err = c.Categorize(ctx, product)
+		if err != nil {
+			recategorizeJobs.update(jobID, func(job *RecategorizeJob) {
+				job.Processed++
+				job.Failed++
+				if len(job.Errors) < maxJobErrors {
+					job.Errors = append(job.Errors, ObjectError{ID: product.ID, Name: product.Name, Message: err.Error()})
+				}
+			})
+			return
+		}
+		recategorizeCache.put(ctx, key, result)
+	}
+
+	hash := product.ContentHash
+	if hash == "" {
+		hash = contentHash(product)
+	}
+
+	outcome := func(job *RecategorizeJob) { job.Unchanged++ }
+	switch {
+	case strings.EqualFold(result.Category, product.Category):
+		categoryReviews.withdraw(ctx, product.ID)
+	case result.Confidence < minConfidence:
+		outcome = func(job *RecategorizeJob) { job.LowConfidence++ }
+	default:
+		queued := categoryReviews.propose(ctx, CategoryProposal{
+			ProductID:        product.ID,
+			ProductName:      product.Name,
+			CurrentCategory:  product.Category,
+			ProposedCategory: result.Category,
+			ProposedPath:     taxonomy.path(result.Category),
+			Confidence:       result.Confidence,
+			ContentHash:      hash,
+			JobID:            jobID,
+			CreatedAt:        time.Now().UTC(),
+		})
+		outcome = func(job *RecategorizeJob) { job.Proposed++ }
+		if !queued {
+			outcome = func(job *RecategorizeJob) { job.Rejected++ }
+		}
+	}
+
+	recategorizeJobs.update(jobID, func(job *RecategorizeJob) {
+		job.Processed++
+		if cached {
+			job.Cached++
+		}
+		outcome(job)
+	})
+}
+
+// startRecategorize serves POST /categories/recategorize.
+func startRecategorize(c *gin.Context) {
+	var req RecategorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.MinConfidence < 0 || req.MinConfidence > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_confidence must be between 0 and 1"})
+		return
+	}
+
+	jobID, started := recategorizeJobs.create(func(job *RecategorizeJob) {
+		job.MinConfidence = req.MinConfidence
+		job.Errors = []ObjectError{}
+	})
+	if !started {
+		c.JSON(http.StatusConflict, gin.H{"error": errRecategorizeRunning.Error(), "job_id": jobID})
+		return
+	}
+
+	go func() {
+		recategorizeJobs.begin(jobID)
+		err := runRecategorize(context.Background(), jobID, req.MinConfidence)
+		job := recategorizeJobs.finish(jobID, err)
+		log.Printf("Recategorize job %s %s: %d processed, %d cached, %d proposed, %d failed",
+			job.ID, job.Status, job.Processed, job.Cached, job.Proposed, job.Failed)
+	}()
+
+	c.Header("Location", "/categories/recategorize/jobs/"+jobID)
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "status": jobPending})
+}
+
+func getRecategorizeJob(c *gin.Context) {
+	job, ok := recategorizeJobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// listCategoryReviews serves GET /categories/review. ?status selects
+// pending (the default), accepted, rejected, stale or all proposals.
+func listCategoryReviews(c *gin.Context) {
+	status := c.DefaultQuery("status", proposalPending)
+	switch status {
+	case proposalPending, proposalAccepted, proposalRejected, proposalStale:
+	case "all":
+		status = ""
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown status %q", status)})
+		return
+	}
+
+	proposals := categoryReviews.list(status)
+	c.JSON(http.StatusOK, gin.H{"proposals": proposals, "count": len(proposals)})
+}
+
+// acceptCategoryReview writes the proposed category, provided the product has
+// not changed since the proposal was made. The proposal is taken before the
+// product is read, so two accepts of it cannot both write.
+func acceptCategoryReview(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	proposal, err := categoryReviews.review(ctx, id, proposalAccepted)
+	switch {
+	case errors.Is(err, errNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "proposal not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "proposal": proposal})
+		return
+	}
+
+	product, err := store.Get(ctx, id)
+	if errors.Is(err, errNotFound) {
+		proposal = categoryReviews.revise(ctx, id, proposalStale)
+		c.JSON(http.StatusConflict, gin.H{"error": "product no longer exists", "proposal": proposal})
+		return
+	}
+	if err != nil {
+		categoryReviews.revise(ctx, id, proposalPending)
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if product.ContentHash != "" && product.ContentHash != proposal.ContentHash {
+		proposal = categoryReviews.revise(ctx, id, proposalStale)
+		c.JSON(http.StatusConflict, gin.H{"error": errProposalStale.Error(), "proposal": proposal})
+		return
+	}
+
+	product.Category = proposal.ProposedCategory
+	if err := upsertProduct(ctx, &product); err != nil {
+		categoryReviews.revise(ctx, id, proposalPending)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"proposal": proposal, "product": product})
+}
+
+func rejectCategoryReview(c *gin.Context) {
+	proposal, err := categoryReviews.review(c.Request.Context(), c.Param("id"), proposalRejected)
+	switch {
+	case errors.Is(err, errNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "proposal not found"})
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "proposal": proposal})
+	default:
+		c.JSON(http.StatusOK, gin.H{"proposal": proposal})
+	}
+}
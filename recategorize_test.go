@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useReviewQueue gives the test an empty review queue, cache and job
+// registry.
+func useReviewQueue(t *testing.T) {
+	t.Helper()
+	previousReviews, previousCache, previousJobs := categoryReviews, recategorizeCache, recategorizeJobs
+	categoryReviews = &reviewQueue{proposals: map[string]*CategoryProposal{}}
+	recategorizeCache = &categorizationCache{results: map[string]Categorization{}}
+	recategorizeJobs = newJobRegistry[RecategorizeJob](true)
+	t.Cleanup(func() {
+		categoryReviews, recategorizeCache, recategorizeJobs = previousReviews, previousCache, previousJobs
+	})
+}
+
+// queuedProposal returns the proposal for a product, whatever its status.
+func queuedProposal(productID string) (CategoryProposal, bool) {
+	for _, p := range categoryReviews.list("") {
+		if p.ProductID == productID {
+			return p, true
+		}
+	}
+	return CategoryProposal{}, false
+}
+
+func TestReviewQueue(t *testing.T) {
+	useReviewQueue(t)
+	q := categoryReviews
+	ctx := context.Background()
+	proposal := CategoryProposal{ProductID: "p1", ProposedCategory: "headphones", ContentHash: "h1"}
+
+	if !q.propose(ctx, proposal) {
+		t.Fatalf("first proposal not queued")
+	}
+	if !q.propose(ctx, proposal) || len(q.list(proposalPending)) != 1 {
+		t.Errorf("repeating a pending proposal should keep one pending proposal")
+	}
+
+	if _, err := q.review(ctx, "p1", proposalRejected); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+	if _, err := q.review(ctx, "p1", proposalAccepted); !errors.Is(err, errProposalNotPending) {
+		t.Errorf("reviewing twice: got %v, want errProposalNotPending", err)
+	}
+	if _, err := q.review(ctx, "missing", proposalAccepted); !errors.Is(err, errNotFound) {
+		t.Errorf("reviewing an unknown proposal: got %v, want errNotFound", err)
+	}
+
+	if q.propose(ctx, proposal) {
+		t.Errorf("a rejected change was proposed again for the same content")
+	}
+	edited := proposal
+	edited.ContentHash = "h2"
+	if !q.propose(ctx, edited) {
+		t.Errorf("a rejected change should be proposed again once the product changed")
+	}
+	if got, _ := queuedProposal("p1"); got.Status != proposalPending || got.ContentHash != "h2" {
+		t.Errorf("got %+v, want the pending proposal for the new content", got)
+	}
+
+	q.withdraw(ctx, "p1")
+	if _, ok := queuedProposal("p1"); ok {
+		t.Errorf("withdrawn proposal still queued")
+	}
+}
+
+func TestRecategorizeOne(t *testing.T) {
+	useReviewQueue(t)
+	ctx := context.Background()
+	jobID, _ := recategorizeJobs.create(nil)
+	product := Product{ID: "p1", Name: "Sony WH-1000XM5", Category: "audio"}
+
+	// counts are the job's processed, cached, proposed, low confidence,
+	// unchanged and failed counts.
+	type counts [6]int
+	steps := []struct {
+		name     string
+		answer   stubCategorizer
+		hash     string
+		wantJob  counts
+		wantOpen bool
+	}{
+		{"confident change is proposed", stubCategorizer{result: Categorization{Category: "headphones", Confidence: 0.9}}, "h1",
+			counts{1, 0, 1, 0, 0, 0}, true},
+		{"same content is answered from the cache", stubCategorizer{err: errors.New("not called")}, "h1",
+			counts{2, 1, 2, 0, 0, 0}, true},
+		{"unsure change is not proposed", stubCategorizer{result: Categorization{Category: "speakers", Confidence: 0.2}}, "h2",
+			counts{3, 1, 2, 1, 0, 0}, true},
+		{"agreeing answer withdraws the proposal", stubCategorizer{result: Categorization{Category: "Audio", Confidence: 0.9}}, "h3",
+			counts{4, 1, 2, 1, 1, 0}, false},
+		{"failure is counted", stubCategorizer{err: errors.New("model unavailable")}, "h4",
+			counts{5, 1, 2, 1, 1, 1}, false},
+	}
+
+	for _, step := range steps {
+		recategorizeOne(ctx, jobID, step.answer, product, step.hash, 0.5)
+		job, _ := recategorizeJobs.get(jobID)
+		got := counts{job.Processed, job.Cached, job.Proposed, job.LowConfidence, job.Unchanged, job.Failed}
+		if got != step.wantJob {
+			t.Errorf("%s: job counts %+v, want %+v", step.name, got, step.wantJob)
+		}
+		if _, open := queuedProposal(product.ID); open != step.wantOpen {
+			t.Errorf("%s: proposal queued %t, want %t", step.name, open, step.wantOpen)
+		}
+	}
+}
+
+func newReviewRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/categories/review", listCategoryReviews)
+	r.POST("/categories/review/:id/accept", acceptCategoryReview)
+	r.POST("/categories/review/:id/reject", rejectCategoryReview)
+	return r
+}
+
+func TestCategoryReviewHandlers(t *testing.T) {
+	useReviewQueue(t)
+	s := useMemoryStore(t,
+		Product{Name: "Sony WH-1000XM5", Description: "Headphones", Category: "audio"},
+		Product{Name: "JBL Flip 6", Description: "Speaker", Category: "audio"},
+		Product{Name: "Dell XPS 13", Description: "Laptop", Category: "electronics"},
+	)
+	ctx := context.Background()
+	r := newReviewRouter()
+
+	stored, err := s.List(ctx, ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	byName := map[string]Product{}
+	for _, p := range stored {
+		byName[p.Name] = p
+		categoryReviews.propose(ctx, CategoryProposal{
+			ProductID: p.ID, ProductName: p.Name, CurrentCategory: p.Category,
+			ProposedCategory: "gaming", ContentHash: p.ContentHash, CreatedAt: time.Now().UTC(),
+		})
+	}
+	sony, jbl, dell := byName["Sony WH-1000XM5"], byName["JBL Flip 6"], byName["Dell XPS 13"]
+
+	// The product changes after the proposal was made.
+	dell.Description = "Laptop with 32GB RAM"
+	if err := upsertProduct(ctx, &dell); err != nil {
+		t.Fatalf("upsertProduct: %v", err)
+	}
+
+	steps := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"accept", "/categories/review/" + sony.ID + "/accept", http.StatusOK},
+		{"accept twice", "/categories/review/" + sony.ID + "/accept", http.StatusConflict},
+		{"reject", "/categories/review/" + jbl.ID + "/reject", http.StatusOK},
+		{"accept rejected", "/categories/review/" + jbl.ID + "/accept", http.StatusConflict},
+		{"accept stale", "/categories/review/" + dell.ID + "/accept", http.StatusConflict},
+		{"accept unknown", "/categories/review/unknown/accept", http.StatusNotFound},
+		{"reject unknown", "/categories/review/unknown/reject", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if w := serve(r, http.MethodPost, step.path, ""); w.Code != step.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body.String())
+		}
+	}
+
+	for name, want := range map[string]string{"Sony WH-1000XM5": "gaming", "JBL Flip 6": "audio", "Dell XPS 13": "electronics"} {
+		got, err := s.Get(ctx, byName[name].ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Category != want {
+			t.Errorf("%s has category %q, want %q", name, got.Category, want)
+		}
+	}
+	for status, want := range map[string]string{proposalAccepted: sony.ID, proposalRejected: jbl.ID, proposalStale: dell.ID} {
+		if got := categoryReviews.list(status); len(got) != 1 || got[0].ProductID != want {
+			t.Errorf("%s proposals %+v, want only %s", status, got, want)
+		}
+	}
+
+	if w := serve(r, http.MethodGet, "/categories/review?status=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown status: got %d, want 400", w.Code)
+	}
+}
+
+// metaMemoryStore is a memory store that also keeps bookkeeping, like the
+// Weaviate store's meta class.
+type metaMemoryStore struct {
+	*memoryStore
+	meta map[string]string
+}
+
+func (s *metaMemoryStore) getMeta(ctx context.Context, key string) (string, error) {
+	value, ok := s.meta[key]
+	if !ok {
+		return "", errNotFound
+	}
+	return value, nil
+}
+
+func (s *metaMemoryStore) setMeta(ctx context.Context, key, value string) error {
+	s.meta[key] = value
+	return nil
+}
+
+func (s *metaMemoryStore) listMeta(ctx context.Context, prefix string) (map[string]string, error) {
+	values := map[string]string{}
+	for key, value := range s.meta {
+		if strings.HasPrefix(key, prefix) {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+func (s *metaMemoryStore) deleteMeta(ctx context.Context, key string) error {
+	delete(s.meta, key)
+	return nil
+}
+
+func TestCategoryReviewsSurviveRestart(t *testing.T) {
+	useReviewQueue(t)
+	s := &metaMemoryStore{memoryStore: useMemoryStore(t), meta: map[string]string{}}
+	store = s
+	ctx := context.Background()
+	jobID, _ := recategorizeJobs.create(nil)
+
+	product := Product{ID: "p1", Name: "Sony WH-1000XM5", Description: "Headphones", Category: "audio"}
+	key := categorizationKey(product)
+	recategorizeOne(ctx, jobID, stubCategorizer{result: Categorization{Category: "headphones", Confidence: 0.9}}, product, key, 0)
+	if _, err := categoryReviews.review(ctx, "p1", proposalRejected); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+
+	// A restart starts from empty in-memory state.
+	categoryReviews = &reviewQueue{proposals: map[string]*CategoryProposal{}}
+	recategorizeCache = &categorizationCache{results: map[string]Categorization{}}
+	loadCategoryReviews(ctx)
+
+	if got, ok := queuedProposal("p1"); !ok || got.Status != proposalRejected || got.ProposedCategory != "headphones" {
+		t.Errorf("restored proposal %+v, %t, want the rejected headphones proposal", got, ok)
+	}
+	if got, ok := recategorizeCache.get(key); !ok || got.Category != "headphones" {
+		t.Errorf("restored cache entry %+v, %t, want headphones", got, ok)
+	}
+
+	// Only the name and description reach the model, so other edits keep
+	// the cached answer.
+	product.Price = float64Ptr(399)
+	if categorizationKey(product) != key {
+		t.Errorf("price changed the categorization key")
+	}
+	product.Description = "Over-ear headphones"
+	if categorizationKey(product) == key {
+		t.Errorf("description did not change the categorization key")
+	}
+}
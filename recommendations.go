@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getSimilarProducts recommends products close to a stored product's own
+// vector, so typos in a name cannot derail it and the seed is never returned.
+func getSimilarProducts(c *gin.Context) {
+	limit, err := queryLimit(c, 5)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seed, err := store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := SearchOptions{
+		Limit:      limit,
+		ExcludeIDs: []string{seed.ID},
+	}
+
+	// category=same keeps to the seed's category (e.g. alternatives),
+	// category=different leaves it (e.g. accessories for a phone).
+	switch c.Query("category") {
+	case "":
+	case "same":
+		opts.Filters = &SearchFilters{Category: seed.Category}
+	case "different":
+		opts.Filters = &SearchFilters{Properties: []PropertyFilter{
+			{Property: "category", Operator: "not_equals", Value: seed.Category},
+		}}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category must be same or different"})
+		return
+	}
+
+	products, err := store.NearObject(c.Request.Context(), seed.ID, opts)
+	if err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := SearchResponse{
+		Products: products,
+		Count:    len(products),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BasketRequest asks for products that go with a set of seed products, such
+// as a cart or browsing history.
+type BasketRequest struct {
+	Products []WeightedProduct `json:"products" binding:"required,min=1,dive"`
+	// Negative products push results away, e.g. items the user dismissed.
+	Negative []WeightedProduct `json:"negative" binding:"dive"`
+	Limit    int               `json:"limit"`
+	Filters  *SearchFilters    `json:"filters"`
+	// MoveAwayForce controls how strongly negatives repel, from 0 to 1.
+	MoveAwayForce *float64 `json:"move_away_force"`
+}
+
+type WeightedProduct struct {
+	ID string `json:"id" binding:"required"`
+	// Weight defaults to 1.
+	Weight *float64 `json:"weight"`
+}
+
+// recommendForBasket combines the seed vectors into one query vector and
+// searches with it. Weaviate only supports moveTo/moveAwayFrom on nearText,
+// so the moves are applied here and the result is sent as a nearVector.
+func recommendForBasket(c *gin.Context) {
+	var req BasketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := checkLimit(req.Limit, 5)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Limit = limit
+
+	force := 0.5
+	if req.MoveAwayForce != nil {
+		force = *req.MoveAwayForce
+	}
+	if force < 0 || force > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "move_away_force must be between 0 and 1"})
+		return
+	}
+
+	if err := req.Filters.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSeeds(req.Products); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Negative) > 0 {
+		if err := validateSeeds(req.Negative); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "negative: " + err.Error()})
+			return
+		}
+	}
+
+	positive, positiveIDs, err := weightedCentroid(c, req.Products)
+	if err != nil {
+		c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	query := positive
+	excluded := positiveIDs
+	if len(req.Negative) > 0 {
+		negative, negativeIDs, err := weightedCentroid(c, req.Negative)
+		if err != nil {
+			c.JSON(storeErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		query = moveAwayFrom(positive, negative, force)
+		excluded = append(excluded, negativeIDs...)
+	}
+
+	products, err := store.NearVector(c.Request.Context(), query, SearchOptions{
+		Limit:      req.Limit,
+		Filters:    req.Filters,
+		ExcludeIDs: excluded,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := SearchResponse{
+		Products: products,
+		Count:    len(products),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func validateSeeds(seeds []WeightedProduct) error {
+	totalWeight := 0.0
+	for _, seed := range seeds {
+		weight := seedWeight(seed)
+		if weight < 0 {
+			return fmt.Errorf("weight for %s cannot be negative; list it under negative instead", seed.ID)
+		}
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		return errors.New("at least one product needs a positive weight")
+	}
+	return nil
+}
+
+func seedWeight(seed WeightedProduct) float64 {
+	if seed.Weight == nil {
+		return 1
+	}
+	return *seed.Weight
+}
+
+// weightedCentroid looks up the stored vectors of the given products and
+// returns their weighted, normalized average along with the IDs used. Seeds
+// must have been checked with validateSeeds.
+func weightedCentroid(c *gin.Context, seeds []WeightedProduct) ([]float32, []string, error) {
+	var sum []float64
+	ids := make([]string, 0, len(seeds))
+
+	for _, seed := range seeds {
+		weight := seedWeight(seed)
+		vector, err := store.GetVector(c.Request.Context(), seed.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("product %s: %w", seed.ID, err)
+		}
+		if sum == nil {
+			sum = make([]float64, len(vector))
+		}
+		if len(vector) != len(sum) {
+			return nil, nil, fmt.Errorf("product %s has a %d-dimensional vector, expected %d", seed.ID, len(vector), len(sum))
+		}
+
+		unit := normalize(toFloat64s(vector))
+		for i, v := range unit {
+			sum[i] += weight * float64(v)
+		}
+		ids = append(ids, seed.ID)
+	}
+
+	return normalize(sum), ids, nil
+}
+
+// moveAwayFrom pushes a query vector away from a negative direction with
+// the given force and renormalizes it.
+func moveAwayFrom(query, negative []float32, force float64) []float32 {
+	moved := make([]float64, len(query))
+	for i := range query {
+		moved[i] = float64(query[i]) - force*float64(negative[i])
+	}
+	return normalize(moved)
+}
+
+func toFloat64s(vector []float32) []float64 {
+	out := make([]float64, len(vector))
+	for i, v := range vector {
+		out[i] = float64(v)
+	}
+	return out
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetSimilarProducts(t *testing.T) {
+	useMemoryStore(t, testCatalog()...)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/products/:id/similar", getSimilarProducts)
+
+	sony := productID(Product{SKU: "WH-1000XM5"})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		// want is every returned product, sorted.
+		want []string
+	}{
+		{"excludes the seed", "/products/" + sony + "/similar?limit=10", http.StatusOK,
+			[]string{"Bose QuietComfort Earbuds", "Dell XPS 13", "JBL Flip 6", "MacBook Air"}},
+		{"limit", "/products/" + sony + "/similar?limit=1", http.StatusOK, nil},
+		{"same category", "/products/" + productID(Product{Name: "Dell XPS 13"}) + "/similar?category=same", http.StatusOK,
+			[]string{"MacBook Air"}},
+		{"different category", "/products/" + productID(Product{Name: "MacBook Air"}) + "/similar?category=different", http.StatusOK,
+			[]string{"Bose QuietComfort Earbuds", "JBL Flip 6", "Sony WH-1000XM5"}},
+		{"unknown category mode", "/products/" + sony + "/similar?category=other", http.StatusBadRequest, nil},
+		{"zero limit", "/products/" + sony + "/similar?limit=0", http.StatusBadRequest, nil},
+		{"limit above the maximum", "/products/" + sony + "/similar?limit=101", http.StatusBadRequest, nil},
+		{"unknown seed", "/products/" + productID(Product{Name: "Missing"}) + "/similar", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.path, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response SearchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			got := productNames(response.Products)
+			if tt.want == nil {
+				if len(got) != 1 || got[0] == "Sony WH-1000XM5" {
+					t.Errorf("got %v, want one product other than the seed", got)
+				}
+				return
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// axisEmbedder embeds each product name as a fixed vector, so centroids can
+// be checked by hand.
+type axisEmbedder map[string][]float32
+
+func (e axisEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector, ok := e[strings.TrimSpace(text)]
+		if !ok {
+			return nil, errors.New("no vector for " + text)
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// useAxisStore stores one product per named vector.
+func useAxisStore(t *testing.T, vectors axisEmbedder) {
+	t.Helper()
+	s := newMemoryStore(vectors)
+	products := make([]Product, 0, len(vectors))
+	for name := range vectors {
+		products = append(products, Product{ID: name, Name: name})
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	if _, err := s.Upsert(context.Background(), products); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	previous := store
+	store = s
+	t.Cleanup(func() { store = previous })
+}
+
+func approxEqual(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-6 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWeightedCentroid(t *testing.T) {
+	useAxisStore(t, axisEmbedder{
+		"x":    {2, 0, 0},
+		"y":    {0, 1, 0},
+		"z":    {0, 0, 3},
+		"flat": {0, 0},
+	})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/recommendations", nil)
+	half := float32(math.Sqrt(0.5))
+
+	tests := []struct {
+		name    string
+		seeds   []WeightedProduct
+		want    []float32
+		wantErr bool
+	}{
+		{"one seed is normalized", []WeightedProduct{{ID: "x"}}, []float32{1, 0, 0}, false},
+		{"vectors count equally whatever their length", []WeightedProduct{{ID: "x"}, {ID: "z"}}, []float32{half, 0, half}, false},
+		{"weights", []WeightedProduct{{ID: "x", Weight: float64Ptr(3)}, {ID: "y", Weight: float64Ptr(4)}}, []float32{0.6, 0.8, 0}, false},
+		{"zero weight is ignored", []WeightedProduct{{ID: "x", Weight: float64Ptr(0)}, {ID: "y"}}, []float32{0, 1, 0}, false},
+		{"unknown product", []WeightedProduct{{ID: "x"}, {ID: "missing"}}, nil, true},
+		{"mismatched dimensions", []WeightedProduct{{ID: "x"}, {ID: "flat"}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ids, err := weightedCentroid(c, tt.seeds)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("weightedCentroid: %v", err)
+			}
+			if !approxEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if len(ids) != len(tt.seeds) {
+				t.Errorf("got IDs %v, want one per seed", ids)
+			}
+		})
+	}
+}
+
+func TestMoveAwayFrom(t *testing.T) {
+	half := float32(math.Sqrt(0.5))
+
+	tests := []struct {
+		name     string
+		query    []float32
+		negative []float32
+		force    float64
+		want     []float32
+	}{
+		{"no force", []float32{1, 0}, []float32{0, 1}, 0, []float32{1, 0}},
+		{"full force", []float32{1, 0}, []float32{0, 1}, 1, []float32{half, -half}},
+		{"partial force", []float32{half, half}, []float32{0, 1}, 0.5, normalize([]float64{float64(half), float64(half) - 0.5})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := moveAwayFrom(tt.query, tt.negative, tt.force); !approxEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecommendForBasket(t *testing.T) {
+	useMemoryStore(t, testCatalog()...)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/recommendations", recommendForBasket)
+
+	sony := productID(Product{SKU: "WH-1000XM5"})
+	bose := productID(Product{Name: "Bose QuietComfort Earbuds"})
+	dell := productID(Product{Name: "Dell XPS 13"})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		// want is every returned product, sorted.
+		want []string
+	}{
+		{"seeds are excluded", `{"products": [{"id": "` + sony + `"}, {"id": "` + bose + `", "weight": 2}], "limit": 10}`, http.StatusOK,
+			[]string{"Dell XPS 13", "JBL Flip 6", "MacBook Air"}},
+		{"negatives are excluded", `{"products": [{"id": "` + sony + `"}], "negative": [{"id": "` + dell + `"}], "limit": 10}`, http.StatusOK,
+			[]string{"Bose QuietComfort Earbuds", "JBL Flip 6", "MacBook Air"}},
+		{"filters", `{"products": [{"id": "` + sony + `"}], "filters": {"category": "laptops"}}`, http.StatusOK,
+			[]string{"Dell XPS 13", "MacBook Air"}},
+		{"no products", `{"products": []}`, http.StatusBadRequest, nil},
+		{"negative weight", `{"products": [{"id": "` + sony + `", "weight": -1}]}`, http.StatusBadRequest, nil},
+		{"no positive weight", `{"products": [{"id": "` + sony + `", "weight": 0}]}`, http.StatusBadRequest, nil},
+		{"negative limit", `{"products": [{"id": "` + sony + `"}], "limit": -1}`, http.StatusBadRequest, nil},
+		{"limit above the maximum", `{"products": [{"id": "` + sony + `"}], "limit": 101}`, http.StatusBadRequest, nil},
+		{"force out of range", `{"products": [{"id": "` + sony + `"}], "negative": [{"id": "` + dell + `"}], "move_away_force": 2}`, http.StatusBadRequest, nil},
+		{"unknown product", `{"products": [{"id": "` + productID(Product{Name: "Missing"}) + `"}]}`, http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/recommendations", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response SearchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			got := productNames(response.Products)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// productAlias is the stable name of the product index. Until the first
+// reindex it is also the class name; afterwards the alias entry in the meta
+// class maps it to the current Product_vN class.
+const productAlias = "Product"
+
+const (
+	aliasKey         = "alias:" + productAlias
+	previousAliasKey = "alias_previous:" + productAlias
+)
+
+// reindexPasses bounds how often a reindex catches up with writes made to the
+// live class while it was copying.
+const reindexPasses = 3
+
+var (
+	errNoRollback     = errors.New("no previous class to roll back to")
+	errReindexRunning = errors.New("a reindex is already running")
+)
+
+// reindexer is implemented by stores that can rebuild the index next to the
+// live one and switch over without downtime.
+type reindexer interface {
+	// Reindex copies every product into a new class, re-embedding it with
+	// embedder (or the current embedder if nil), and switches to it.
+	Reindex(ctx context.Context, embedder *EmbedderConfig, update func(fn func(job *ReindexJob))) error
+	// Rollback switches back to the class that was live before the last
+	// switch and returns its name.
+	Rollback(ctx context.Context) (string, error)
+}
+
+// ReindexJob tracks one background reindex.
+type ReindexJob struct {
+	jobState
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Embedder string `json:"embedder,omitempty"`
+	// Total is the number of products in the live class when the copy
+	// started.
+	Total  int `json:"total"`
+	Copied int `json:"copied"`
+	Failed int `json:"failed"`
+}
+
+func (j *ReindexJob) clone() ReindexJob { return *j }
+
+// reindexJobs runs one reindex at a time.
+var reindexJobs = newJobRegistry[ReindexJob](true)
+
+type ReindexRequest struct {
+	// Embedder re-embeds the catalog with a different model. Without it the
+	// current embedder is kept, e.g. to apply a schema change.
+	Embedder *EmbedderConfig `json:"embedder"`
+}
+
+// startReindex builds a new class in the background and switches to it once
+// it is complete; searches keep using the current class until then.
+func startReindex(c *gin.Context) {
+	target, ok := store.(reindexer)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the configured vector store does not support reindexing"})
+		return
+	}
+
+	var req ReindexRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Embedder != nil {
+		switch req.Embedder.Kind {
+		case "openai", "openai-compatible", "local":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown embedder kind %q", req.Embedder.Kind)})
+			return
+		}
+	}
+
+	jobID, started := reindexJobs.create(nil)
+	if !started {
+		c.JSON(http.StatusConflict, gin.H{"error": errReindexRunning.Error(), "job_id": jobID})
+		return
+	}
+
+	go func() {
+		reindexJobs.begin(jobID)
+		err := target.Reindex(context.Background(), req.Embedder, func(fn func(job *ReindexJob)) {
+			reindexJobs.update(jobID, fn)
+		})
+		job := reindexJobs.finish(jobID, err)
+		log.Printf("Reindex job %s %s: %s -> %s, %d of %d copied", job.ID, job.Status, job.From, job.To, job.Copied, job.Total)
+	}()
+
+	c.Header("Location", "/reindex/jobs/"+jobID)
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "status": jobPending})
+}
+
+func getReindexJob(c *gin.Context) {
+	job, ok := reindexJobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// rollbackReindex switches searches back to the class that was live before
+// the last reindex.
+func rollbackReindex(c *gin.Context) {
+	target, ok := store.(reindexer)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the configured vector store does not support reindexing"})
+		return
+	}
+
+	className, err := target.Rollback(c.Request.Context())
+	if errors.Is(err, errNoRollback) || errors.Is(err, errReindexRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"class": className})
+}
+
+func (s *weaviateStore) Reindex(ctx context.Context, embedderConfig *EmbedderConfig, update func(fn func(job *ReindexJob))) error {
+	if !s.switching.TryLock() {
+		return errReindexRunning
+	}
+	defer s.switching.Unlock()
+
+	from, embedder := s.active()
+	source := s.forClass(from, embedder)
+
+	cfg, ok, err := s.embedderConfig(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		cfg = embedderConfigFromEnv()
+	}
+	if embedderConfig != nil {
+		cfg = embedderConfig.withDefaults()
+		embedder = newEmbedderFromConfig(cfg)
+	}
+
+	to, err := s.nextClassName(ctx)
+	if err != nil {
+		return err
+	}
+	total, err := source.Count(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("counting %s: %w", from, err)
+	}
+	update(func(job *ReindexJob) {
+		job.From = from
+		job.To = to
+		job.Total = total
+		job.Embedder = cfg.String()
+	})
+
+	if err := s.client.Schema().ClassCreator().WithClass(productSchema(to)).Do(ctx); err != nil {
+		return fmt.Errorf("creating class %s: %w", to, err)
+	}
+	next := s.forClass(to, embedder)
+	err = s.copyClass(ctx, source, next, update)
+	if err == nil {
+		// From here on writes are recorded: verifyCopy skips the products
+		// they touch and the final pass copies just those.
+		s.trackWrites()
+		defer s.stopTrackingWrites()
+		err = verifyCopy(ctx, source, next, s.wasWritten)
+	}
+	if err == nil {
+		err = next.setSchemaVersion(ctx, schemaVersion)
+	}
+	if err == nil {
+		err = s.setEmbedderConfig(ctx, to, cfg)
+	}
+	if err == nil {
+		err = s.switchClass(ctx, source, next)
+	}
+	if err != nil {
+		// A partial class is no use for rollback either.
+		if dropErr := s.client.Schema().ClassDeleter().WithClassName(to).Do(ctx); dropErr != nil {
+			log.Printf("Error dropping incomplete class %s: %v", to, dropErr)
+		}
+		return err
+	}
+	log.Printf("Alias %s switched from %s to %s", productAlias, from, to)
+	return nil
+}
+
+// switchClass pauses writes, copies the products written since tracking
+// started and points the alias at next. Writes resume once the store uses
+// next, so none can reach source after it was read for the last time.
+func (s *weaviateStore) switchClass(ctx context.Context, source, next *weaviateStore) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	writer := newBatchWriter()
+	writer.target = next
+	if err := copyWritten(ctx, source, writer, s.stopTrackingWrites()); err != nil {
+		return err
+	}
+
+	to, embedder := next.active()
+	if err := s.setMeta(ctx, previousAliasKey, source.class()); err != nil {
+		return err
+	}
+	if err := s.setMeta(ctx, aliasKey, to); err != nil {
+		return err
+	}
+	s.activate(to, embedder)
+	return nil
+}
+
+// copyClass copies every product from source into next and catches up with
+// writes made to source in the meantime. verifyCopy and switchClass finish
+// the job.
+func (s *weaviateStore) copyClass(ctx context.Context, source, next *weaviateStore, update func(fn func(job *ReindexJob))) error {
+	writer := newBatchWriter()
+	writer.target = next
+
+	after := ""
+	for {
+		page, err := source.List(ctx, ListOptions{Limit: syncPageSize, After: after})
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", source.class(), err)
+		}
+		summary := writer.write(ctx, page, nil)
+		update(func(job *ReindexJob) {
+			job.Copied += summary.Inserted
+			job.Failed += summary.Failed
+		})
+		if summary.Failed > 0 {
+			return fmt.Errorf("%d products could not be copied, first error: %s", summary.Failed, summary.Errors[0].Message)
+		}
+		if len(page) < syncPageSize {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+
+	for pass := 0; pass < reindexPasses; pass++ {
+		changed, err := catchUp(ctx, source, writer)
+		if err != nil {
+			return err
+		}
+		if changed == 0 {
+			break
+		}
+		log.Printf("Reindex caught up with %d products changed during the copy", changed)
+	}
+	return nil
+}
+
+// verifyCopy catches up with source once more and checks that next then
+// holds every product of source and nothing else. Products written is true
+// for may still be in flight; the final pass under paused writes copies
+// them.
+func verifyCopy(ctx context.Context, source, next VectorStore, written func(id string) bool) error {
+	writer := newBatchWriter()
+	writer.target = next
+	if _, err := catchUp(ctx, source, writer); err != nil {
+		return err
+	}
+
+	changed, removed, err := diffCopy(ctx, source, next)
+	if err != nil {
+		return err
+	}
+	differ := 0
+	for _, product := range changed {
+		if !written(product.ID) {
+			differ++
+		}
+	}
+	for _, id := range removed {
+		if !written(id) {
+			differ++
+		}
+	}
+	if differ > 0 {
+		return fmt.Errorf("copy does not match after catching up: %d products missing or different", differ)
+	}
+	return nil
+}
+
+// catchUp writes products created or changed in source since they were
+// copied and deletes products removed from it, returning how many changed.
+func catchUp(ctx context.Context, source VectorStore, writer *batchWriter) (int, error) {
+	changed, removed, err := diffCopy(ctx, source, writer.target)
+	if err != nil {
+		return 0, err
+	}
+	if err := applyCopy(ctx, writer, changed, removed); err != nil {
+		return 0, err
+	}
+	return len(changed) + len(removed), nil
+}
+
+// copyWritten brings the products with the given IDs up to date in the
+// writer's target, deleting those no longer in source.
+func copyWritten(ctx context.Context, source VectorStore, writer *batchWriter, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	found, err := source.GetMany(ctx, ids)
+	if err != nil {
+		return err
+	}
+	changed := make([]Product, 0, len(found))
+	removed := []string{}
+	for _, id := range ids {
+		if product, ok := found[id]; ok {
+			changed = append(changed, product)
+		} else {
+			removed = append(removed, id)
+		}
+	}
+	return applyCopy(ctx, writer, changed, removed)
+}
+
+// diffCopy compares target with source, returning the products missing from
+// target or different there and the IDs target has but source does not.
+func diffCopy(ctx context.Context, source, target VectorStore) ([]Product, []string, error) {
+	copied, err := indexedHashes(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changed := []Product{}
+	after := ""
+	for {
+		page, err := source.List(ctx, ListOptions{Limit: syncPageSize, After: after})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, product := range page {
+			// Hashes are recomputed because products written before
+			// content hashes existed have none stored.
+			hash, ok := copied[product.ID]
+			if !ok || hash != contentHash(product) {
+				changed = append(changed, product)
+			}
+			delete(copied, product.ID)
+		}
+		if len(page) < syncPageSize {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+
+	// Whatever is left was deleted from source after it was copied.
+	removed := make([]string, 0, len(copied))
+	for id := range copied {
+		removed = append(removed, id)
+	}
+	return changed, removed, nil
+}
+
+func applyCopy(ctx context.Context, writer *batchWriter, changed []Product, removed []string) error {
+	if summary := writer.write(ctx, changed, nil); summary.Failed > 0 {
+		return fmt.Errorf("%d products could not be copied, first error: %s", summary.Failed, summary.Errors[0].Message)
+	}
+	for _, id := range removed {
+		if err := writer.target.Delete(ctx, id); err != nil && !errors.Is(err, errNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *weaviateStore) Rollback(ctx context.Context) (string, error) {
+	if !s.switching.TryLock() {
+		return "", errReindexRunning
+	}
+	defer s.switching.Unlock()
+
+	previous, err := s.getMeta(ctx, previousAliasKey)
+	if err != nil {
+		return "", err
+	}
+	if previous == "" {
+		return "", errNoRollback
+	}
+	exists, err := s.client.Schema().ClassExistenceChecker().WithClassName(previous).Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("checking class existence: %w", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: class %s no longer exists", errNoRollback, previous)
+	}
+
+	// Writes pause for the switch, as they do for a reindex, so none is
+	// still going to the class the alias leaves.
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	current, embedder := s.active()
+	if cfg, ok, err := s.embedderConfig(ctx, previous); err != nil {
+		return "", err
+	} else if ok {
+		embedder = newEmbedderFromConfig(cfg)
+	}
+
+	if err := s.setMeta(ctx, previousAliasKey, current); err != nil {
+		return "", err
+	}
+	if err := s.setMeta(ctx, aliasKey, previous); err != nil {
+		return "", err
+	}
+	s.activate(previous, embedder)
+	log.Printf("Alias %s rolled back from %s to %s", productAlias, current, previous)
+	return previous, nil
+}
+
+// nextClassName returns Product_vN for the first N above every existing
+// version. The original unversioned class counts as version 1.
+func (s *weaviateStore) nextClassName(ctx context.Context) (string, error) {
+	schema, err := s.client.Schema().Getter().Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("reading schema: %w", err)
+	}
+
+	latest := 1
+	for _, class := range schema.Classes {
+		suffix, ok := strings.CutPrefix(class.Class, productAlias+"_v")
+		if !ok {
+			continue
+		}
+		if version, err := strconv.Atoi(suffix); err == nil && version > latest {
+			latest = version
+		}
+	}
+	return fmt.Sprintf("%s_v%d", productAlias, latest+1), nil
+}
+
+func embedderKey(className string) string {
+	return "embedder:" + className
+}
+
+// embedderConfig returns the embedder recorded for a class, if any.
+func (s *weaviateStore) embedderConfig(ctx context.Context, className string) (EmbedderConfig, bool, error) {
+	value, err := s.getMeta(ctx, embedderKey(className))
+	if err != nil || value == "" {
+		return EmbedderConfig{}, false, err
+	}
+
+	var cfg EmbedderConfig
+	if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+		return EmbedderConfig{}, false, fmt.Errorf("invalid embedder config for %s: %w", className, err)
+	}
+	return cfg.withDefaults(), true, nil
+}
+
+func (s *weaviateStore) setEmbedderConfig(ctx context.Context, className string, cfg EmbedderConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.setMeta(ctx, embedderKey(className), string(data))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// storeContents lists every product in a store by name with its content hash.
+func storeContents(t *testing.T, s VectorStore) map[string]string {
+	t.Helper()
+	products, err := s.List(context.Background(), ListOptions{Limit: 1000})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	contents := map[string]string{}
+	for _, p := range products {
+		contents[p.Name] = contentHash(p)
+	}
+	return contents
+}
+
+func TestCatchUp(t *testing.T) {
+	ctx := context.Background()
+	catalog := testCatalog()
+
+	source := newMemoryStore(newLocalEmbedder(0))
+	if _, err := source.Upsert(ctx, catalog); err != nil {
+		t.Fatal(err)
+	}
+
+	// The copy has fallen behind: the first product was created after it
+	// was copied, the second was edited, and a product since deleted from
+	// the source is still in the copy.
+	next := newMemoryStore(newLocalEmbedder(0))
+	stale := append([]Product{}, catalog[1:]...)
+	stale[0].Description = "Old description"
+	stale = append(stale, Product{Name: "Discontinued", Category: "cameras"})
+	if _, err := next.Upsert(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := &batchWriter{target: next, chunkSize: 2}
+	changed, err := catchUp(ctx, source, writer)
+	if err != nil {
+		t.Fatalf("catchUp: %v", err)
+	}
+	if changed != 3 {
+		t.Errorf("first pass changed %d products, want 3", changed)
+	}
+	if got, want := storeContents(t, next), storeContents(t, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("copy holds %v, want %v", got, want)
+	}
+
+	changed, err = catchUp(ctx, source, writer)
+	if err != nil {
+		t.Fatalf("catchUp: %v", err)
+	}
+	if changed != 0 {
+		t.Errorf("second pass changed %d products, want none", changed)
+	}
+}
+
+// lossyStore reports every write as successful but drops the products
+// named in lost.
+type lossyStore struct {
+	*memoryStore
+	lost map[string]bool
+}
+
+func (s *lossyStore) Upsert(ctx context.Context, products []Product) ([]ObjectError, error) {
+	kept := []Product{}
+	for _, p := range products {
+		if !s.lost[p.Name] {
+			kept = append(kept, p)
+		}
+	}
+	return s.memoryStore.Upsert(ctx, kept)
+}
+
+// keyedCatalog is the test catalog with IDs assigned.
+func keyedCatalog() []Product {
+	catalog := testCatalog()
+	for i := range catalog {
+		catalog[i].ID = productKey(catalog[i])
+	}
+	return catalog
+}
+
+func TestVerifyCopy(t *testing.T) {
+	ctx := context.Background()
+	catalog := keyedCatalog()
+	nothingWritten := func(string) bool { return false }
+
+	tests := []struct {
+		name string
+		// lose is written to the copy but never lands, as if the store
+		// dropped it.
+		lose    bool
+		written func(id string) bool
+		wantErr bool
+	}{
+		{"complete copy", false, nothingWritten, false},
+		{"lost product", true, nothingWritten, true},
+		{"lost product still being written", true, func(id string) bool { return id == catalog[0].ID }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newMemoryStore(newLocalEmbedder(0))
+			if _, err := source.Upsert(ctx, catalog); err != nil {
+				t.Fatal(err)
+			}
+			next := &lossyStore{memoryStore: newMemoryStore(newLocalEmbedder(0))}
+			if tt.lose {
+				next.lost = map[string]bool{catalog[0].Name: true}
+			}
+
+			err := verifyCopy(ctx, source, next, tt.written)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyCopy error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCopyWritten(t *testing.T) {
+	ctx := context.Background()
+	catalog := keyedCatalog()
+
+	source := newMemoryStore(newLocalEmbedder(0))
+	if _, err := source.Upsert(ctx, catalog); err != nil {
+		t.Fatal(err)
+	}
+	next := newMemoryStore(newLocalEmbedder(0))
+	if _, err := next.Upsert(ctx, catalog); err != nil {
+		t.Fatal(err)
+	}
+
+	// While writes were tracked the first product was edited, the second
+	// deleted and a new one created. The rest of the copy is stale too,
+	// but only the written products are copied.
+	edited := catalog[0]
+	edited.Description = "New description"
+	created := Product{ID: productID(Product{Name: "Kindle"}), Name: "Kindle", Category: "e-readers"}
+	if _, err := source.Upsert(ctx, []Product{edited, created}); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Delete(ctx, catalog[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	untracked := catalog[2]
+	untracked.Description = "Changed without being tracked"
+	if _, err := source.Upsert(ctx, []Product{untracked}); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := &batchWriter{target: next, chunkSize: 2}
+	if err := copyWritten(ctx, source, writer, []string{edited.ID, created.ID, catalog[1].ID}); err != nil {
+		t.Fatalf("copyWritten: %v", err)
+	}
+
+	got := storeContents(t, next)
+	want := storeContents(t, source)
+	want[untracked.Name] = contentHash(catalog[2])
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("copy holds %v, want %v", got, want)
+	}
+}
+
+func TestWriteTracking(t *testing.T) {
+	s := &weaviateStore{}
+	s.recordWrite("before")
+	s.trackWrites()
+	s.recordWrite("during")
+	if !s.wasWritten("during") || s.wasWritten("before") {
+		t.Errorf("only writes after trackWrites should be recorded")
+	}
+	if got := s.stopTrackingWrites(); !reflect.DeepEqual(got, []string{"during"}) {
+		t.Errorf("stopTrackingWrites = %v, want [during]", got)
+	}
+	s.recordWrite("after")
+	if s.wasWritten("after") {
+		t.Errorf("writes after stopTrackingWrites should not be recorded")
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// schemaVersion is the version of productSchema. Bump it whenever a property
+// is added or changed so the migration runner knows the live class is behind.
+const schemaVersion = 6
+
+var indexOff = false
+
+// productSchema is the declarative definition of the Product class. The live
+// class is compared against it at startup and missing properties are added;
+// anything else that differs is reported as drift and needs a reindex.
+func productSchema(className string) *models.Class {
+	class := &models.Class{
+		Class:       className,
+		Description: "Product catalog",
+		Properties: []*models.Property{
+			{
+				Name:         "sku",
+				DataType:     []string{"text"},
+				Tokenization: models.PropertyTokenizationField,
+			},
+			{
+				Name:     "name",
+				DataType: []string{"text"},
+			},
+			{
+				Name:     "description",
+				DataType: []string{"text"},
+			},
+			{
+				// Field tokenization keeps "smart-home" a single token so
+				// category filters match exactly.
+				Name:         "category",
+				DataType:     []string{"text"},
+				Tokenization: models.PropertyTokenizationField,
+			},
+			{
+				// Path from the taxonomy root to the category, so filters
+				// can match any level. Added in version 5.
+				Name:         "category_path",
+				DataType:     []string{"text[]"},
+				Tokenization: models.PropertyTokenizationField,
+			},
+			{
+				Name:     "brand",
+				DataType: []string{"text"},
+			},
+			{
+				Name:     "price",
+				DataType: []string{"number"},
+			},
+			{
+				// ISO 4217 code, matched exactly.
+				Name:         "currency",
+				DataType:     []string{"text"},
+				Tokenization: models.PropertyTokenizationField,
+			},
+			{
+				Name:     "in_stock",
+				DataType: []string{"boolean"},
+			},
+			{
+				Name:            "url",
+				DataType:        []string{"text"},
+				IndexFilterable: &indexOff,
+				IndexSearchable: &indexOff,
+			},
+			{
+				Name:            "image_url",
+				DataType:        []string{"text"},
+				IndexFilterable: &indexOff,
+				IndexSearchable: &indexOff,
+			},
+			{
+				// Tags are normalized to lower case on the way in, so field
+				// tokenization matches them whole.
+				Name:         "tags",
+				DataType:     []string{"text[]"},
+				Tokenization: models.PropertyTokenizationField,
+			},
+			{
+				Name:     "created_at",
+				DataType: []string{"date"},
+			},
+			{
+				Name:     "updated_at",
+				DataType: []string{"date"},
+			},
+			{
+				// JSON-encoded map of extra catalog attributes.
+				Name:            "attributes",
+				DataType:        []string{"text"},
+				IndexFilterable: &indexOff,
+				IndexSearchable: &indexOff,
+			},
+			{
+				// Added in version 2 for incremental sync; brand through
+				// updated_at were added in version 3.
+				Name:            "content_hash",
+				DataType:        []string{"text"},
+				Tokenization:    models.PropertyTokenizationField,
+				IndexSearchable: &indexOff,
+			},
+			{
+				// Hash of the catalog record, so a sync can skip unchanged
+				// records before inferring anything. Added in version 6.
+				Name:            "source_hash",
+				DataType:        []string{"text"},
+				Tokenization:    models.PropertyTokenizationField,
+				IndexSearchable: &indexOff,
+			},
+		},
+		// Vectors come from the service's Embedder, not a Weaviate module.
+		Vectorizer: "none",
+	}
+
+	// Spec properties were added in version 4.
+	for _, def := range specDefinitions {
+		prop := &models.Property{
+			Name:        def.Name,
+			DataType:    []string{def.DataType},
+			Description: def.Description,
+		}
+		if def.DataType == "text" {
+			prop.Tokenization = models.PropertyTokenizationField
+		}
+		class.Properties = append(class.Properties, prop)
+	}
+	return class
+}
+
+// schemaDiff is the difference between productSchema and a live class.
+type schemaDiff struct {
+	// Missing properties can be added in place.
+	Missing []*models.Property
+	// Drift lists differences that cannot be migrated in place, such as a
+	// changed data type or tokenization.
+	Drift []string
+}
+
+func diffSchema(want, live *models.Class) schemaDiff {
+	diff := schemaDiff{}
+
+	if live.Vectorizer != want.Vectorizer {
+		diff.Drift = append(diff.Drift, fmt.Sprintf("vectorizer is %q, expected %q", live.Vectorizer, want.Vectorizer))
+	}
+
+	liveProps := make(map[string]*models.Property, len(live.Properties))
+	for _, prop := range live.Properties {
+		liveProps[prop.Name] = prop
+	}
+
+	for _, prop := range want.Properties {
+		existing, ok := liveProps[prop.Name]
+		if !ok {
+			diff.Missing = append(diff.Missing, prop)
+			continue
+		}
+		delete(liveProps, prop.Name)
+
+		if got, expected := strings.Join(existing.DataType, ","), strings.Join(prop.DataType, ","); got != expected {
+			diff.Drift = append(diff.Drift, fmt.Sprintf("property %s has data type %s, expected %s", prop.Name, got, expected))
+			continue
+		}
+		if got, expected := tokenization(existing), tokenization(prop); got != expected {
+			diff.Drift = append(diff.Drift, fmt.Sprintf("property %s has tokenization %q, expected %q", prop.Name, got, expected))
+		}
+		if got, expected := indexEnabled(existing.IndexFilterable, true), indexEnabled(prop.IndexFilterable, true); got != expected {
+			diff.Drift = append(diff.Drift, fmt.Sprintf("property %s has indexFilterable %t, expected %t", prop.Name, got, expected))
+		}
+		isText := strings.HasPrefix(prop.DataType[0], "text")
+		if got, expected := indexEnabled(existing.IndexSearchable, isText), indexEnabled(prop.IndexSearchable, isText); got != expected {
+			diff.Drift = append(diff.Drift, fmt.Sprintf("property %s has indexSearchable %t, expected %t", prop.Name, got, expected))
+		}
+	}
+
+	extra := make([]string, 0, len(liveProps))
+	for name := range liveProps {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		diff.Drift = append(diff.Drift, fmt.Sprintf("property %s is not in the schema definition", name))
+	}
+	return diff
+}
+
+// tokenization returns the effective tokenization, which Weaviate defaults to
+// "word" for text properties.
+func tokenization(prop *models.Property) string {
+	if prop.Tokenization == "" && strings.HasPrefix(prop.DataType[0], "text") {
+		return models.PropertyTokenizationWord
+	}
+	return prop.Tokenization
+}
+
+func indexEnabled(flag *bool, defaultValue bool) bool {
+	if flag == nil {
+		return defaultValue
+	}
+	return *flag
+}
+
+// migrateSchema brings an existing class up to productSchema: missing
+// properties are added, unless SCHEMA_AUTO_MIGRATE is "false", and drift is
+// logged. The applied version is recorded in the meta class.
+func (s *weaviateStore) migrateSchema(ctx context.Context) error {
+	className := s.class()
+	live, err := s.client.Schema().ClassGetter().WithClassName(className).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("reading class %s: %w", className, err)
+	}
+
+	version, err := s.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		log.Printf("Warning: class %s is at schema version %d, newer than this build's %d", className, version, schemaVersion)
+	}
+
+	diff := diffSchema(productSchema(className), live)
+	for _, drift := range diff.Drift {
+		log.Printf("Schema drift in %s: %s", className, drift)
+	}
+
+	if len(diff.Missing) > 0 {
+		if os.Getenv("SCHEMA_AUTO_MIGRATE") == "false" {
+			for _, prop := range diff.Missing {
+				log.Printf("Schema drift in %s: property %s is missing (SCHEMA_AUTO_MIGRATE is off)", className, prop.Name)
+			}
+			return nil
+		}
+		for _, prop := range diff.Missing {
+			if err := s.client.Schema().PropertyCreator().WithClassName(className).WithProperty(prop).Do(ctx); err != nil {
+				return fmt.Errorf("adding property %s: %w", prop.Name, err)
+			}
+			log.Printf("Added property %s to class %s", prop.Name, className)
+		}
+	}
+
+	if version < schemaVersion {
+		if err := s.setSchemaVersion(ctx, schemaVersion); err != nil {
+			return err
+		}
+		log.Printf("Migrated class %s from schema version %d to %d", className, version, schemaVersion)
+	}
+	return nil
+}
+
+// metaClassName holds service bookkeeping, such as the schema version, as
+// key/value objects next to the product data.
+const metaClassName = "IndexMeta"
+
+var metaNamespace = uuid.MustParse("2f6a0c9e-7d0b-4f4e-9a55-3c1c6e0b8d21")
+
+func (s *weaviateStore) ensureMetaClass(ctx context.Context) error {
+	exists, err := s.client.Schema().ClassExistenceChecker().WithClassName(metaClassName).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("checking class existence: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	class := &models.Class{
+		Class:       metaClassName,
+		Description: "Service bookkeeping",
+		Properties: []*models.Property{
+			{Name: "key", DataType: []string{"text"}, Tokenization: models.PropertyTokenizationField},
+			{Name: "value", DataType: []string{"text"}, IndexFilterable: &indexOff, IndexSearchable: &indexOff},
+		},
+		Vectorizer: "none",
+	}
+	if err := s.client.Schema().ClassCreator().WithClass(class).Do(ctx); err != nil {
+		return fmt.Errorf("creating class %s: %w", metaClassName, err)
+	}
+	return nil
+}
+
+// getMeta returns the value stored under key, or "" if there is none.
+func (s *weaviateStore) getMeta(ctx context.Context, key string) (string, error) {
+	objects, err := s.client.Data().ObjectsGetter().
+		WithClassName(metaClassName).
+		WithID(metaID(key)).
+		Do(ctx)
+	if err := notFoundOr(err); err != nil {
+		if errors.Is(err, errNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading %s: %w", key, err)
+	}
+	if len(objects) == 0 {
+		return "", nil
+	}
+	props, _ := objects[0].Properties.(map[string]interface{})
+	return getString(props, "value"), nil
+}
+
+func (s *weaviateStore) setMeta(ctx context.Context, key, value string) error {
+	obj := &models.Object{
+		Class:      metaClassName,
+		ID:         strfmt.UUID(metaID(key)),
+		Properties: map[string]interface{}{"key": key, "value": value},
+	}
+	responses, err := s.client.Batch().ObjectsBatcher().WithObjects(obj).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", key, err)
+	}
+	for _, response := range responses {
+		if response.Result != nil && response.Result.Errors != nil && len(response.Result.Errors.Error) > 0 {
+			return fmt.Errorf("writing %s: %s", key, response.Result.Errors.Error[0].Message)
+		}
+	}
+	return nil
+}
+
+// listMeta returns every value whose key starts with prefix, by key.
+func (s *weaviateStore) listMeta(ctx context.Context, prefix string) (map[string]string, error) {
+	values := map[string]string{}
+	after := ""
+	for {
+		getter := s.client.Data().ObjectsGetter().
+			WithClassName(metaClassName).
+			WithLimit(syncPageSize)
+		if after != "" {
+			getter = getter.WithAfter(after)
+		}
+		objects, err := getter.Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s*: %w", prefix, err)
+		}
+		for _, obj := range objects {
+			props, _ := obj.Properties.(map[string]interface{})
+			if key := getString(props, "key"); strings.HasPrefix(key, prefix) {
+				values[key] = getString(props, "value")
+			}
+		}
+		if len(objects) < syncPageSize {
+			return values, nil
+		}
+		after = string(objects[len(objects)-1].ID)
+	}
+}
+
+func (s *weaviateStore) deleteMeta(ctx context.Context, key string) error {
+	err := s.client.Data().Deleter().WithClassName(metaClassName).WithID(metaID(key)).Do(ctx)
+	if err := notFoundOr(err); err != nil && !errors.Is(err, errNotFound) {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func metaID(key string) string {
+	return uuid.NewSHA1(metaNamespace, []byte(key)).String()
+}
+
+func schemaVersionKey(className string) string {
+	return "schema_version:" + className
+}
+
+// schemaVersion returns the recorded schema version of the class. Classes
+// created before versioning existed report 1.
+func (s *weaviateStore) schemaVersion(ctx context.Context) (int, error) {
+	value, err := s.getMeta(ctx, schemaVersionKey(s.class()))
+	if err != nil || value == "" {
+		return 1, err
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", value, err)
+	}
+	return version, nil
+}
+
+func (s *weaviateStore) setSchemaVersion(ctx context.Context, version int) error {
+	return s.setMeta(ctx, schemaVersionKey(s.class()), strconv.Itoa(version))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+func TestDiffSchema(t *testing.T) {
+	indexOn := true
+
+	tests := []struct {
+		name string
+		// edit changes a fresh copy of the schema into the live class.
+		edit        func(live *models.Class)
+		wantMissing []string
+		wantDrift   []string
+	}{
+		{
+			name: "up to date",
+			edit: func(live *models.Class) {},
+		},
+		{
+			name: "explicit defaults are not drift",
+			edit: func(live *models.Class) {
+				name := property(live, "name")
+				name.Tokenization = models.PropertyTokenizationWord
+				name.IndexSearchable = &indexOn
+				name.IndexFilterable = &indexOn
+			},
+		},
+		{
+			name: "missing properties can be added",
+			edit: func(live *models.Class) {
+				kept := []*models.Property{}
+				for _, prop := range live.Properties {
+					if prop.Name != "attributes" && prop.Name != "content_hash" {
+						kept = append(kept, prop)
+					}
+				}
+				live.Properties = kept
+			},
+			wantMissing: []string{"attributes", "content_hash"},
+		},
+		{
+			name: "changed tokenization",
+			edit: func(live *models.Class) {
+				property(live, "category").Tokenization = ""
+			},
+			wantDrift: []string{`property category has tokenization "word", expected "field"`},
+		},
+		{
+			name: "changed data type",
+			edit: func(live *models.Class) {
+				property(live, "sku").DataType = []string{"int"}
+			},
+			wantDrift: []string{"property sku has data type int, expected text"},
+		},
+		{
+			name: "changed indexes",
+			edit: func(live *models.Class) {
+				attributes := property(live, "attributes")
+				attributes.IndexFilterable = nil
+				attributes.IndexSearchable = nil
+			},
+			wantDrift: []string{
+				"property attributes has indexFilterable true, expected false",
+				"property attributes has indexSearchable true, expected false",
+			},
+		},
+		{
+			name: "extra properties and vectorizer",
+			edit: func(live *models.Class) {
+				live.Vectorizer = "text2vec-openai"
+				live.Properties = append(live.Properties,
+					&models.Property{Name: "legacy", DataType: []string{"text"}},
+					&models.Property{Name: "colour", DataType: []string{"text"}},
+				)
+			},
+			wantDrift: []string{
+				`vectorizer is "text2vec-openai", expected "none"`,
+				"property colour is not in the schema definition",
+				"property legacy is not in the schema definition",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := productSchema("Product")
+			for i, prop := range live.Properties {
+				copied := *prop
+				live.Properties[i] = &copied
+			}
+			tt.edit(live)
+
+			diff := diffSchema(productSchema("Product"), live)
+			var missing []string
+			for _, prop := range diff.Missing {
+				missing = append(missing, prop.Name)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("missing %v, want %v", missing, tt.wantMissing)
+			}
+			if !reflect.DeepEqual(diff.Drift, tt.wantDrift) {
+				t.Errorf("drift %q, want %q", diff.Drift, tt.wantDrift)
+			}
+		})
+	}
+}
+
+func property(class *models.Class, name string) *models.Property {
+	for _, prop := range class.Properties {
+		if prop.Name == name {
+			return prop
+		}
+	}
+	panic("no property " + name)
+}
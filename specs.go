@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// specDefinition describes a structured spec pulled out of product text. Each
+// spec is stored as its own typed property so it can be filtered on.
+type specDefinition struct {
+	Name string
+	// DataType is the Weaviate data type: "number", "text" or "boolean".
+	DataType    string
+	Description string
+	// Patterns find the spec in text. For number and text specs the first
+	// capture group is the value; for boolean specs any match means true.
+	Patterns []*regexp.Regexp
+}
+
+// specDefinitions are the specs the extractor knows about, in the order they
+// are reported.
+var specDefinitions = []specDefinition{
+	{
+		Name:        "battery_hours",
+		DataType:    "number",
+		Description: "battery life in hours",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)[\s-]*(?:hours?|hrs?|h)\b[^.,;]{0,20}?battery`),
+			regexp.MustCompile(`(?i)battery[^.,;]{0,30}?(\d+(?:\.\d+)?)[\s-]*(?:hours?|hrs?|h)\b`),
+		},
+	},
+	{
+		Name:        "camera_mp",
+		DataType:    "number",
+		Description: "main camera or sensor resolution in megapixels",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(?:MP|megapixels?)\b`),
+		},
+	},
+	{
+		Name:        "screen_inches",
+		DataType:    "number",
+		Description: "screen diagonal in inches",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)(\d{1,2}(?:\.\d)?)[\s-]*(?:inch(?:es)?\b|")`),
+		},
+	},
+	{
+		Name:        "optical_zoom",
+		DataType:    "number",
+		Description: "optical zoom factor",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)x\s*(?:optical|telephoto)?\s*zoom`),
+		},
+	},
+	{
+		Name:        "storage_gb",
+		DataType:    "number",
+		Description: "storage capacity in GB",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)(\d+(?:\.\d+)?\s*[GT]B)\s*(?:of\s*)?(?:storage|SSD|flash)`),
+		},
+	},
+	{
+		Name:        "ram_gb",
+		DataType:    "number",
+		Description: "memory in GB",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)(\d+)\s*GB\s*(?:of\s*)?(?:RAM|unified memory|memory|LPDDR\w*)`),
+		},
+	},
+	{
+		Name:        "chip",
+		DataType:    "text",
+		Description: "processor or chip name",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\b([AM]\d{1,2}(?: (?:Pro|Max|Ultra|Bionic))?) chip\b`),
+			regexp.MustCompile(`\b(Snapdragon \d+(?: Gen \d)?|Tensor G\d|Intel Core (?:Ultra )?[i\d][\w-]*|Ryzen \d+ \w+)`),
+		},
+	},
+	{
+		Name:        "video_resolution",
+		DataType:    "text",
+		Description: "maximum video resolution such as 4K or 8K",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\b(\d+(?:\.\d)?K)\s*video`),
+		},
+	},
+	{
+		Name:        "noise_cancelling",
+		DataType:    "boolean",
+		Description: "has active noise cancellation",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)noise[\s-]*cancel(?:l)?(?:ing|ation)|\bANC\b`),
+		},
+	},
+	{
+		Name:        "waterproof",
+		DataType:    "boolean",
+		Description: "is waterproof or water resistant",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)waterproof|water[\s-]resistant|\bIP[X\d]?[78]\b`),
+		},
+	},
+}
+
+func init() {
+	for _, def := range specDefinitions {
+		propertyTypes[def.Name] = def.DataType
+		// CSV columns named after a spec are read as that spec.
+		productFieldNames = append(productFieldNames, def.Name)
+	}
+}
+
+func findSpec(name string) (specDefinition, bool) {
+	for _, def := range specDefinitions {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return specDefinition{}, false
+}
+
+// extractSpecs pulls structured specs out of a product's name and description
+// with the extractor chosen by SPEC_EXTRACTOR ("rules", the default, or "ai").
+func extractSpecs(name, description string) map[string]interface{} {
+	if os.Getenv("SPEC_EXTRACTOR") == "ai" {
+		return extractSpecsAI(name, description)
+	}
+	return extractSpecsRules(name, description)
+}
+
+// AI-powered spec extraction using OpenAI. The rule-based specs are the
+// baseline; values the model finds take precedence.
+func extractSpecsAI(name, description string) map[string]interface{} {
+	specs := extractSpecsRules(name, description)
+
+	fields := make([]string, len(specDefinitions))
+	for i, def := range specDefinitions {
+		fields[i] = fmt.Sprintf("- %s (%s): %s", def.Name, def.DataType, def.Description)
+	}
+	prompt := fmt.Sprintf(`Extract these specs from the product below:
+%s
+
+Product: %s
+Description: %s
+
+Return only a JSON object with the specs that are stated in the text, using the keys above. Omit anything that is not stated.`,
+		strings.Join(fields, "\n"), name, description)
+
+	reply, err := chatCompletion(context.Background(), prompt, 200)
+	if err != nil {
+		log.Printf("Error extracting specs with OpenAI: %v", err)
+		return specs
+	}
+
+	reply = stripCodeFence(reply)
+	var found map[string]interface{}
+	if err := json.Unmarshal([]byte(reply), &found); err != nil {
+		log.Printf("Error decoding specs from OpenAI: %v", err)
+		return specs
+	}
+
+	for key, value := range found {
+		def, ok := findSpec(key)
+		if !ok || value == nil {
+			continue
+		}
+		if coerced, err := coerceSpec(def, value); err == nil {
+			specs[def.Name] = coerced
+		}
+	}
+	return specs
+}
+
+func extractSpecsRules(name, description string) map[string]interface{} {
+	text := name + ". " + description
+	specs := map[string]interface{}{}
+
+	for _, def := range specDefinitions {
+		for _, pattern := range def.Patterns {
+			match := pattern.FindStringSubmatch(text)
+			if match == nil {
+				continue
+			}
+			if def.DataType == "boolean" {
+				specs[def.Name] = true
+				break
+			}
+			if value, err := coerceSpec(def, match[1]); err == nil {
+				specs[def.Name] = value
+				break
+			}
+		}
+	}
+	return specs
+}
+
+// coerceSpec converts a raw value to the spec's data type. Number specs
+// accept strings with units, and storage in TB is converted to GB.
+func coerceSpec(def specDefinition, value interface{}) (interface{}, error) {
+	switch def.DataType {
+	case "number":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			s := strings.ToUpper(strings.TrimSpace(v))
+			scale := 1.0
+			if strings.HasSuffix(s, "TB") {
+				scale = 1024
+			}
+			s = strings.TrimRight(s, " ABCDEFGHIJKLMNOPQRSTUVWXYZ\"")
+			if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return n * scale, nil
+			}
+		}
+		return nil, fmt.Errorf("%s must be a number", def.Name)
+	case "boolean":
+		b, err := parseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", def.Name, err)
+		}
+		return b, nil
+	default:
+		s, ok := value.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, fmt.Errorf("%s must be a string", def.Name)
+		}
+		return strings.TrimSpace(s), nil
+	}
+}
+
+// applySpecs fills in the specs extracted from the product's text. Specs the
+// product already has, e.g. from a catalog column, are kept.
+func applySpecs(p *Product) {
+	for name, value := range extractSpecs(p.Name, p.Description) {
+		if _, ok := p.Specs[name]; ok {
+			continue
+		}
+		if p.Specs == nil {
+			p.Specs = map[string]interface{}{}
+		}
+		p.Specs[name] = value
+	}
+}
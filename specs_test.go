@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractSpecsRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		productName string
+		description string
+		want        map[string]interface{}
+	}{
+		{
+			name:        "headphones",
+			productName: "Sony WH-1000XM5",
+			description: "Wireless noise cancelling headphones with 30 hour battery life",
+			want:        map[string]interface{}{"noise_cancelling": true, "battery_hours": 30.0},
+		},
+		{
+			name:        "battery before hours",
+			productName: "Fitbit Charge 6",
+			description: "Fitness tracker with battery life of up to 7 days or 168 hrs",
+			want:        map[string]interface{}{"battery_hours": 168.0},
+		},
+		{
+			name:        "phone",
+			productName: "iPhone 15 Pro",
+			description: "6.1 inch display, 48MP camera, A17 Pro chip, 256GB storage, 5x optical zoom and 4K video",
+			want: map[string]interface{}{
+				"screen_inches": 6.1, "camera_mp": 48.0, "chip": "A17 Pro", "storage_gb": 256.0,
+				"optical_zoom": 5.0, "video_resolution": "4K",
+			},
+		},
+		{
+			name:        "terabytes are converted",
+			productName: "MacBook Pro 14",
+			description: "M3 Max chip, 36GB unified memory and 1TB SSD",
+			want:        map[string]interface{}{"chip": "M3 Max", "ram_gb": 36.0, "storage_gb": 1024.0},
+		},
+		{
+			name:        "name and description both count",
+			productName: `Dell XPS 13"`,
+			description: "Intel Core Ultra 7 laptop with 16GB RAM",
+			want:        map[string]interface{}{"screen_inches": 13.0, "chip": "Intel Core Ultra 7", "ram_gb": 16.0},
+		},
+		{
+			name:        "ip rating",
+			productName: "JBL Flip 6",
+			description: "Portable speaker, IP67 dust and water protection",
+			want:        map[string]interface{}{"waterproof": true},
+		},
+		{
+			name:        "nothing to extract",
+			productName: "Ceramic Mug",
+			description: "Holds 350 ml of coffee",
+			want:        map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractSpecsRules(tt.productName, tt.description)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractSpecsRules(%q, %q) = %v, want %v", tt.productName, tt.description, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+var (
+	errNotFound      = errors.New("product not found")
+	errProductExists = errors.New("product already exists")
+)
+
+// VectorStore is the persistence layer behind the API. Handlers only talk to
+// this interface so the service can run against Weaviate or fully in memory.
+type VectorStore interface {
+	EnsureSchema(ctx context.Context) error
+	Upsert(ctx context.Context, products []Product) ([]ObjectError, error)
+	Get(ctx context.Context, id string) (Product, error)
+	// GetMany returns the products that exist among ids, keyed by ID.
+	GetMany(ctx context.Context, ids []string) (map[string]Product, error)
+	GetVector(ctx context.Context, id string) ([]float32, error)
+	List(ctx context.Context, opts ListOptions) ([]Product, error)
+	Delete(ctx context.Context, id string) error
+	NearText(ctx context.Context, query string, opts SearchOptions) ([]Product, error)
+	NearVector(ctx context.Context, vector []float32, opts SearchOptions) ([]Product, error)
+	NearObject(ctx context.Context, id string, opts SearchOptions) ([]Product, error)
+	Keyword(ctx context.Context, query string, opts SearchOptions) ([]Product, error)
+	Hybrid(ctx context.Context, query string, alpha float32, opts SearchOptions) ([]Product, error)
+	Count(ctx context.Context, filters *SearchFilters) (int, error)
+}
+
+// ObjectError is a failure reported for a single product in a batch write.
+// The rest of the batch may still have been written.
+type ObjectError struct {
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"error"`
+}
+
+// metaStore is implemented by stores that keep service bookkeeping, such as
+// the category review queue, next to the products so it survives restarts.
+type metaStore interface {
+	getMeta(ctx context.Context, key string) (string, error)
+	setMeta(ctx context.Context, key, value string) error
+	// listMeta returns every value whose key starts with prefix, by key.
+	listMeta(ctx context.Context, prefix string) (map[string]string, error)
+	deleteMeta(ctx context.Context, key string) error
+}
+
+// upsertProduct writes one product, treating an object-level failure as an
+// error. The product's timestamps are updated in place.
+func upsertProduct(ctx context.Context, product *Product) error {
+	products := []Product{*product}
+	if err := stampTimestamps(ctx, store, products); err != nil {
+		return err
+	}
+	*product = products[0]
+	product.CategoryPath = taxonomy.path(product.Category)
+
+	objectErrors, err := store.Upsert(ctx, products)
+	if err != nil {
+		return err
+	}
+	if len(objectErrors) > 0 {
+		return errors.New(objectErrors[0].Message)
+	}
+	return nil
+}
+
+// ListOptions pages through all products. After, an object ID, takes
+// precedence over Offset and stays efficient however deep the page is.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	After  string
+}
+
+// SearchOptions holds the parameters shared by all ranked searches.
+type SearchOptions struct {
+	Limit   int
+	Offset  int
+	Filters *SearchFilters
+	// ExcludeIDs are left out of the results, e.g. the seed of a
+	// recommendation.
+	ExcludeIDs []string
+	// MinCertainty and MaxDistance only apply to vector searches.
+	MinCertainty *float64
+	MaxDistance  *float64
+}
+
+// distanceCutoff folds MinCertainty and MaxDistance into a single cosine
+// distance threshold, since Weaviate accepts only one of the two.
+func (o SearchOptions) distanceCutoff() (float64, bool) {
+	if o.MinCertainty == nil && o.MaxDistance == nil {
+		return 0, false
+	}
+
+	cutoff := 2.0
+	if o.MaxDistance != nil {
+		cutoff = *o.MaxDistance
+	}
+	if o.MinCertainty != nil {
+		cutoff = math.Min(cutoff, certaintyToDistance(*o.MinCertainty))
+	}
+	return cutoff, true
+}
+
+// certaintyToDistance and distanceToCertainty convert between the two ways
+// Weaviate reports cosine similarity.
+func certaintyToDistance(certainty float64) float64 {
+	return 2 * (1 - certainty)
+}
+
+func distanceToCertainty(distance float64) float64 {
+	return 1 - distance/2
+}
+
+var store VectorStore
+
+// newVectorStore picks the backend from VECTOR_STORE ("weaviate" or "memory").
+func newVectorStore(embedder Embedder) VectorStore {
+	switch backend := getEnv("VECTOR_STORE", "weaviate"); backend {
+	case "memory":
+		log.Printf("Using in-memory vector store")
+		return newMemoryStore(embedder)
+	case "weaviate":
+		return newWeaviateStore(embedder)
+	default:
+		log.Printf("Unknown VECTOR_STORE %q, falling back to weaviate", backend)
+		return newWeaviateStore(embedder)
+	}
+}
+
+// productText is the text that gets embedded for a product.
+func productText(p Product) string {
+	return p.Name + " " + p.Description
+}
+
+// productProperties is the property map stored for a product. The keys match
+// the Weaviate class definition and the names accepted by property filters.
+func productProperties(p Product) map[string]interface{} {
+	props := map[string]interface{}{
+		"sku":         p.SKU,
+		"name":        p.Name,
+		"description": p.Description,
+		"category":    p.Category,
+	}
+	// The path is derived from the taxonomy on every write, so a changed
+	// taxonomy reaches the index with the next sync or reindex.
+	if path := taxonomy.path(p.Category); len(path) > 0 {
+		props["category_path"] = path
+	}
+	// Optional fields are left out when unset so products that never had
+	// them keep the content hash they were stored with.
+	if p.Brand != "" {
+		props["brand"] = p.Brand
+	}
+	if p.Price != nil {
+		props["price"] = *p.Price
+	}
+	if p.Currency != "" {
+		props["currency"] = p.Currency
+	}
+	if p.InStock != nil {
+		props["in_stock"] = *p.InStock
+	}
+	if p.URL != "" {
+		props["url"] = p.URL
+	}
+	if p.ImageURL != "" {
+		props["image_url"] = p.ImageURL
+	}
+	if len(p.Tags) > 0 {
+		props["tags"] = p.Tags
+	}
+	for _, def := range specDefinitions {
+		if value, ok := p.Specs[def.Name]; ok {
+			props[def.Name] = value
+		}
+	}
+	// Attributes are free-form, so they are kept as one JSON text property
+	// rather than growing the schema with every new catalog column.
+	if len(p.Attributes) > 0 {
+		if data, err := json.Marshal(p.Attributes); err == nil {
+			props["attributes"] = string(data)
+		}
+	}
+	props["content_hash"] = hashProperties(props)
+
+	// Timestamps are not content, so they are added after hashing, and so is
+	// the source hash, which describes the catalog record rather than the
+	// product.
+	if p.SourceHash != "" {
+		props["source_hash"] = p.SourceHash
+	}
+	if p.CreatedAt != nil {
+		props["created_at"] = p.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if p.UpdatedAt != nil {
+		props["updated_at"] = p.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	return props
+}
+
+// contentHash fingerprints everything stored for a product, so a sync can
+// tell unchanged products from edited ones without comparing fields.
+func contentHash(p Product) string {
+	return productProperties(p)["content_hash"].(string)
+}
+
+func hashProperties(props map[string]interface{}) string {
+	// json.Marshal sorts map keys, which makes the encoding canonical.
+	data, _ := json.Marshal(props)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// productFromProperties is the inverse of productProperties.
+func productFromProperties(id string, props map[string]interface{}) Product {
+	product := Product{
+		ID:          id,
+		SKU:         getString(props, "sku"),
+		Name:        getString(props, "name"),
+		Description: getString(props, "description"),
+		Category:    getString(props, "category"),
+		Brand:       getString(props, "brand"),
+		Currency:    getString(props, "currency"),
+		URL:         getString(props, "url"),
+		ImageURL:    getString(props, "image_url"),
+		ContentHash: getString(props, "content_hash"),
+		SourceHash:  getString(props, "source_hash"),
+	}
+	if price, ok := toFloat(props["price"]); ok {
+		product.Price = &price
+	}
+	if inStock, ok := props["in_stock"].(bool); ok {
+		product.InStock = &inStock
+	}
+	product.CategoryPath = getStrings(props, "category_path")
+	product.Tags = getStrings(props, "tags")
+	for _, def := range specDefinitions {
+		value, ok := props[def.Name]
+		if !ok || value == nil {
+			continue
+		}
+		if coerced, err := coerceSpec(def, value); err == nil {
+			if product.Specs == nil {
+				product.Specs = map[string]interface{}{}
+			}
+			product.Specs[def.Name] = coerced
+		}
+	}
+	product.CreatedAt = getTime(props, "created_at")
+	product.UpdatedAt = getTime(props, "updated_at")
+	if attributes := getString(props, "attributes"); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &product.Attributes); err != nil {
+			log.Printf("Ignoring invalid attributes on product %s: %v", id, err)
+		}
+	}
+	return product
+}
+
+func getStrings(props map[string]interface{}, key string) []string {
+	switch values := props[key].(type) {
+	case []string:
+		return values
+	case []interface{}:
+		var strs []string
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+func getTime(props map[string]interface{}, key string) *time.Time {
+	value := getString(props, key)
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+// stampTimestamps sets CreatedAt and UpdatedAt before products are written to
+// target. A product already stored keeps its CreatedAt, and its UpdatedAt
+// unless the content changed; new products keep timestamps they came with,
+// e.g. from a catalog or a reindex, and otherwise get the current time.
+func stampTimestamps(ctx context.Context, target VectorStore, products []Product) error {
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = productKey(product)
+	}
+	existing, err := target.GetMany(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("reading existing products: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := range products {
+		product := &products[i]
+		if stored, ok := existing[ids[i]]; ok {
+			product.CreatedAt = stored.CreatedAt
+			product.UpdatedAt = stored.UpdatedAt
+			if stored.ContentHash != contentHash(*product) {
+				product.UpdatedAt = nil
+			}
+		}
+		if product.CreatedAt == nil {
+			product.CreatedAt = &now
+		}
+		if product.UpdatedAt == nil {
+			product.UpdatedAt = &now
+		}
+	}
+	return nil
+}
+
+// embedProducts embeds all products in one call to the embedder.
+func embedProducts(ctx context.Context, embedder Embedder, products []Product) ([][]float32, error) {
+	texts := make([]string, len(products))
+	for i, product := range products {
+		texts[i] = productText(product)
+	}
+
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("embedding products: %w", err)
+	}
+	if len(vectors) != len(products) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d products", len(vectors), len(products))
+	}
+	return vectors, nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+type memoryObject struct {
+	product Product
+	vector  []float32
+}
+
+// memoryStore is a brute-force cosine similarity store for local development
+// and tests. Nothing is persisted between restarts.
+type memoryStore struct {
+	mu       sync.RWMutex
+	embedder Embedder
+	objects  map[string]*memoryObject
+	order    []string
+}
+
+func newMemoryStore(embedder Embedder) *memoryStore {
+	return &memoryStore{
+		embedder: embedder,
+		objects:  make(map[string]*memoryObject),
+	}
+}
+
+func (s *memoryStore) EnsureSchema(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) Upsert(ctx context.Context, products []Product) ([]ObjectError, error) {
+	vectors, err := embedProducts(ctx, s.embedder, products)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, product := range products {
+		if product.ID == "" {
+			product.ID = productID(product)
+		}
+		product.Relevance = nil
+		product.ContentHash = contentHash(product)
+		product.CategoryPath = taxonomy.path(product.Category)
+		if _, exists := s.objects[product.ID]; !exists {
+			s.order = append(s.order, product.ID)
+		}
+		s.objects[product.ID] = &memoryObject{
+			product: product,
+			vector:  vectors[i],
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id string) (Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[id]
+	if !ok {
+		return Product{}, errNotFound
+	}
+	return obj.product, nil
+}
+
+func (s *memoryStore) GetMany(ctx context.Context, ids []string) (map[string]Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	products := make(map[string]Product, len(ids))
+	for _, id := range ids {
+		if obj, ok := s.objects[id]; ok {
+			products[id] = obj.product
+		}
+	}
+	return products, nil
+}
+
+func (s *memoryStore) GetVector(ctx context.Context, id string) ([]float32, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return obj.vector, nil
+}
+
+func (s *memoryStore) List(ctx context.Context, opts ListOptions) ([]Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start := opts.Offset
+	if opts.After != "" {
+		start = len(s.order)
+		for i, id := range s.order {
+			if id == opts.After {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	products := []Product{}
+	for i := start; i < len(s.order) && len(products) < opts.Limit; i++ {
+		products = append(products, s.objects[s.order[i]].product)
+	}
+	return products, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[id]; !ok {
+		return errNotFound
+	}
+	delete(s.objects, id)
+	for i, existing := range s.order {
+		if existing == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) NearText(ctx context.Context, query string, opts SearchOptions) ([]Product, error) {
+	vector, err := embedOne(ctx, s.embedder, query)
+	if err != nil {
+		return nil, err
+	}
+	return s.NearVector(ctx, vector, opts)
+}
+
+func (s *memoryStore) NearVector(ctx context.Context, vector []float32, opts SearchOptions) ([]Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff, hasCutoff := opts.distanceCutoff()
+
+	candidates := []*memoryObject{}
+	scores := []float64{}
+	for _, obj := range s.filtered(opts.Filters, opts.ExcludeIDs) {
+		similarity := cosineSimilarity(vector, obj.vector)
+		if hasCutoff && 1-similarity > cutoff {
+			continue
+		}
+		candidates = append(candidates, obj)
+		scores = append(scores, similarity)
+	}
+
+	return rankProducts(candidates, scores, opts.Offset, opts.Limit, false, func(i int) *Relevance {
+		distance := 1 - scores[i]
+		certainty := distanceToCertainty(distance)
+		return &Relevance{Distance: &distance, Certainty: &certainty}
+	}), nil
+}
+
+func (s *memoryStore) NearObject(ctx context.Context, id string, opts SearchOptions) ([]Product, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errNotFound
+	}
+	return s.NearVector(ctx, obj.vector, opts)
+}
+
+func (s *memoryStore) Keyword(ctx context.Context, query string, opts SearchOptions) ([]Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := s.filtered(opts.Filters, opts.ExcludeIDs)
+	scores := bm25Scores(query, candidates)
+	return rankProducts(candidates, scores, opts.Offset, opts.Limit, true, func(i int) *Relevance {
+		score := scores[i]
+		return &Relevance{Score: &score, ExplainScore: fmt.Sprintf("BM25F score %.4f", score)}
+	}), nil
+}
+
+func (s *memoryStore) Hybrid(ctx context.Context, query string, alpha float32, opts SearchOptions) ([]Product, error) {
+	vector, err := embedOne(ctx, s.embedder, query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := s.filtered(opts.Filters, opts.ExcludeIDs)
+	vectorScores := make([]float64, len(candidates))
+	for i, obj := range candidates {
+		vectorScores[i] = cosineSimilarity(vector, obj.vector)
+	}
+	keywordScores := bm25Scores(query, candidates)
+
+	// Relative score fusion, as Weaviate does: scale each ranking to [0, 1]
+	// and blend them with alpha (1 is pure vector, 0 is pure keyword).
+	normalizeScores(vectorScores)
+	normalizeScores(keywordScores)
+	scores := make([]float64, len(candidates))
+	for i := range candidates {
+		scores[i] = float64(alpha)*vectorScores[i] + float64(1-alpha)*keywordScores[i]
+	}
+	return rankProducts(candidates, scores, opts.Offset, opts.Limit, false, func(i int) *Relevance {
+		score := scores[i]
+		explain := fmt.Sprintf("relative score fusion: vector %.4f, keyword %.4f, alpha %.2f",
+			vectorScores[i], keywordScores[i], alpha)
+		return &Relevance{Score: &score, ExplainScore: explain}
+	}), nil
+}
+
+// filtered returns the objects matching filters in insertion order, minus
+// the excluded IDs. Callers must hold the read lock.
+func (s *memoryStore) filtered(f *SearchFilters, exclude []string) []*memoryObject {
+	objects := make([]*memoryObject, 0, len(s.order))
+	for _, id := range s.order {
+		obj := s.objects[id]
+		if containsString(exclude, id) {
+			continue
+		}
+		if matchesFilters(productProperties(obj.product), f) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// rankProducts orders objects by descending score, applies the page and
+// attaches the relevance built for each kept object. With positiveOnly,
+// objects scoring zero are dropped, matching BM25 which only returns
+// documents that contain a query term.
+func rankProducts(objects []*memoryObject, scores []float64, offset, limit int, positiveOnly bool, relevance func(i int) *Relevance) []Product {
+	indexes := make([]int, 0, len(objects))
+	for i := range objects {
+		if positiveOnly && scores[i] <= 0 {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+
+	// Stable sort keeps insertion order for ties so results are deterministic.
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return scores[indexes[i]] > scores[indexes[j]]
+	})
+
+	if offset >= len(indexes) {
+		indexes = nil
+	} else {
+		indexes = indexes[offset:]
+	}
+	if limit > 0 && len(indexes) > limit {
+		indexes = indexes[:limit]
+	}
+
+	products := make([]Product, 0, len(indexes))
+	for _, i := range indexes {
+		product := objects[i].product
+		product.Relevance = relevance(i)
+		products = append(products, product)
+	}
+	return products
+}
+
+// bm25Scores scores objects against the query with Okapi BM25 over the SKU,
+// name, brand and description. The name is counted twice so title matches win.
+func bm25Scores(query string, objects []*memoryObject) []float64 {
+	const k1, b = 1.2, 0.75
+
+	docs := make([]map[string]int, len(objects))
+	lengths := make([]int, len(objects))
+	docFreq := map[string]int{}
+	totalLength := 0
+
+	for i, obj := range objects {
+		p := obj.product
+		terms := tokenize(p.SKU + " " + p.Name + " " + p.Name + " " + p.Brand + " " + p.Description)
+		counts := map[string]int{}
+		for _, term := range terms {
+			counts[term]++
+		}
+		for term := range counts {
+			docFreq[term]++
+		}
+		docs[i] = counts
+		lengths[i] = len(terms)
+		totalLength += len(terms)
+	}
+
+	scores := make([]float64, len(objects))
+	if len(objects) == 0 {
+		return scores
+	}
+	avgLength := float64(totalLength) / float64(len(objects))
+	n := float64(len(objects))
+
+	for _, term := range tokenize(query) {
+		df := float64(docFreq[term])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i, counts := range docs {
+			tf := float64(counts[term])
+			if tf == 0 {
+				continue
+			}
+			norm := k1 * (1 - b + b*float64(lengths[i])/avgLength)
+			scores[i] += idf * tf * (k1 + 1) / (tf + norm)
+		}
+	}
+	return scores
+}
+
+func normalizeScores(scores []float64) {
+	if len(scores) == 0 {
+		return
+	}
+
+	min, max := scores[0], scores[0]
+	for _, s := range scores {
+		min = math.Min(min, s)
+		max = math.Max(max, s)
+	}
+	for i := range scores {
+		if max == min {
+			scores[i] = 0
+			if max > 0 {
+				scores[i] = 1
+			}
+			continue
+		}
+		scores[i] = (scores[i] - min) / (max - min)
+	}
+}
+
+func (s *memoryStore) Count(ctx context.Context, filters *SearchFilters) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.filtered(filters, nil)), nil
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
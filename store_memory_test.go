@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func float64Ptr(v float64) *float64 { return &v }
+
+func boolPtr(v bool) *bool { return &v }
+
+// useMemoryStore points the global store at a memory store holding products
+// for the rest of the test.
+func useMemoryStore(t *testing.T, products ...Product) *memoryStore {
+	t.Helper()
+	s := newMemoryStore(newLocalEmbedder(0))
+	if _, err := s.Upsert(context.Background(), products); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	previous := store
+	store = s
+	t.Cleanup(func() { store = previous })
+	return s
+}
+
+func productNames(products []Product) []string {
+	names := make([]string, len(products))
+	for i, p := range products {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// testCatalog is a small catalog spread over a few categories. The JBL
+// speaker has no price, so price filters leave it out.
+func testCatalog() []Product {
+	return []Product{
+		{SKU: "WH-1000XM5", Name: "Sony WH-1000XM5", Description: "Wireless noise cancelling headphones with 30 hour battery", Category: "headphones", Brand: "Sony", Price: float64Ptr(399), InStock: boolPtr(true), Tags: []string{"wireless", "anc"}},
+		{Name: "Bose QuietComfort Earbuds", Description: "Noise cancelling earbuds for travel", Category: "earbuds", Brand: "Bose", Price: float64Ptr(279), InStock: boolPtr(false), Tags: []string{"wireless"}},
+		{Name: "Dell XPS 13", Description: "Compact 13 inch laptop with an Intel Core i7", Category: "laptops", Brand: "Dell", Price: float64Ptr(999)},
+		{Name: "MacBook Air", Description: "Thin laptop with the M3 chip", Category: "laptops", Brand: "Apple", Price: float64Ptr(1099)},
+		{Name: "JBL Flip 6", Description: "Portable waterproof speaker", Category: "speakers", Brand: "JBL"},
+	}
+}
+
+func TestMemoryStoreFilters(t *testing.T) {
+	s := useMemoryStore(t, testCatalog()...)
+
+	tests := []struct {
+		name    string
+		filters *SearchFilters
+		want    []string
+	}{
+		{"none", nil, []string{"Bose QuietComfort Earbuds", "Dell XPS 13", "JBL Flip 6", "MacBook Air", "Sony WH-1000XM5"}},
+		{"parent category", &SearchFilters{Category: "audio"}, []string{"Bose QuietComfort Earbuds", "JBL Flip 6", "Sony WH-1000XM5"}},
+		{"leaf category ignores case", &SearchFilters{Category: "Headphones"}, []string{"Sony WH-1000XM5"}},
+		{"root category", &SearchFilters{Category: "electronics"}, []string{"Bose QuietComfort Earbuds", "Dell XPS 13", "JBL Flip 6", "MacBook Air", "Sony WH-1000XM5"}},
+		{"any of categories", &SearchFilters{Categories: []string{"laptops", "speakers"}}, []string{"Dell XPS 13", "JBL Flip 6", "MacBook Air"}},
+		{"sku equals", &SearchFilters{Properties: []PropertyFilter{{Property: "sku", Operator: "equals", Value: "wh-1000xm5"}}}, []string{"Sony WH-1000XM5"}},
+		{"category not equals", &SearchFilters{Properties: []PropertyFilter{{Property: "category", Operator: "not_equals", Value: "laptops"}}}, []string{"Bose QuietComfort Earbuds", "JBL Flip 6", "Sony WH-1000XM5"}},
+		{"name substring", &SearchFilters{Properties: []PropertyFilter{{Property: "name", Operator: "contains", Value: "xps"}}}, []string{"Dell XPS 13"}},
+		{"price max", &SearchFilters{Properties: []PropertyFilter{{Property: "price", Operator: "range", Max: float64Ptr(400)}}}, []string{"Bose QuietComfort Earbuds", "Sony WH-1000XM5"}},
+		{"price min", &SearchFilters{Properties: []PropertyFilter{{Property: "price", Operator: "range", Min: float64Ptr(1000)}}}, []string{"MacBook Air"}},
+		{"brand equals ignores case", &SearchFilters{Properties: []PropertyFilter{{Property: "brand", Operator: "equals", Value: "sony"}}}, []string{"Sony WH-1000XM5"}},
+		{"brand not equals", &SearchFilters{Properties: []PropertyFilter{{Property: "brand", Operator: "not_equals", Value: "Sony"}}}, []string{"Bose QuietComfort Earbuds", "Dell XPS 13", "JBL Flip 6", "MacBook Air"}},
+		{"in stock", &SearchFilters{Properties: []PropertyFilter{{Property: "in_stock", Operator: "equals", Value: true}}}, []string{"Sony WH-1000XM5"}},
+		{"tag", &SearchFilters{Properties: []PropertyFilter{{Property: "tags", Operator: "contains", Value: "anc"}}}, []string{"Sony WH-1000XM5"}},
+		{"combined", &SearchFilters{Category: "laptops", Properties: []PropertyFilter{{Property: "description", Operator: "contains", Value: "thin"}}}, []string{"MacBook Air"}},
+		{"parent category and price", &SearchFilters{Category: "audio", Properties: []PropertyFilter{{Property: "price", Operator: "range", Max: float64Ptr(300)}}}, []string{"Bose QuietComfort Earbuds"}},
+		{"no match", &SearchFilters{Category: "cameras"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filters.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			results, err := s.NearText(context.Background(), "wireless", SearchOptions{Filters: tt.filters})
+			if err != nil {
+				t.Fatalf("NearText: %v", err)
+			}
+			got := productNames(results)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			count, err := s.Count(context.Background(), tt.filters)
+			if err != nil {
+				t.Fatalf("Count: %v", err)
+			}
+			if count != len(tt.want) {
+				t.Errorf("Count = %d, want %d", count, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeyword(t *testing.T) {
+	s := useMemoryStore(t, testCatalog()...)
+
+	tests := []struct {
+		query string
+		// first is the expected top result; want is every result, sorted.
+		first string
+		want  []string
+	}{
+		{"noise cancelling", "", []string{"Bose QuietComfort Earbuds", "Sony WH-1000XM5"}},
+		{"laptop", "", []string{"Dell XPS 13", "MacBook Air"}},
+		{"macbook laptop", "MacBook Air", []string{"Dell XPS 13", "MacBook Air"}},
+		{"JBL", "JBL Flip 6", []string{"JBL Flip 6"}},
+		{"XPS 13", "Dell XPS 13", []string{"Dell XPS 13"}},
+		{"toaster", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := s.Keyword(context.Background(), tt.query, SearchOptions{Limit: 10})
+			if err != nil {
+				t.Fatalf("Keyword: %v", err)
+			}
+			if tt.first != "" && (len(results) == 0 || results[0].Name != tt.first) {
+				t.Errorf("top result %v, want %q", productNames(results), tt.first)
+			}
+			for i := 1; i < len(results); i++ {
+				if *results[i].Relevance.Score > *results[i-1].Relevance.Score {
+					t.Errorf("results not ordered by score: %v", productNames(results))
+				}
+			}
+			got := productNames(results)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeywordPaging(t *testing.T) {
+	s := useMemoryStore(t, testCatalog()...)
+	ctx := context.Background()
+
+	all, err := s.Keyword(ctx, "noise cancelling laptop", SearchOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Keyword: %v", err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %d results, want 4", len(all))
+	}
+
+	var paged []Product
+	for offset := 0; offset < len(all)+1; offset += 2 {
+		page, err := s.Keyword(ctx, "noise cancelling laptop", SearchOptions{Limit: 2, Offset: offset})
+		if err != nil {
+			t.Fatalf("Keyword: %v", err)
+		}
+		paged = append(paged, page...)
+	}
+	if !reflect.DeepEqual(productNames(paged), productNames(all)) {
+		t.Errorf("pages %v, want %v", productNames(paged), productNames(all))
+	}
+}
+
+func TestMemoryStoreHybrid(t *testing.T) {
+	s := useMemoryStore(t, testCatalog()...)
+	ctx := context.Background()
+
+	// With alpha 0 the fusion is pure keyword ranking, though products
+	// without a matching term are still returned after the matches.
+	keyword, err := s.Keyword(ctx, "macbook laptop", SearchOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Keyword: %v", err)
+	}
+	hybrid, err := s.Hybrid(ctx, "macbook laptop", 0, SearchOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Hybrid: %v", err)
+	}
+	if len(hybrid) != len(testCatalog()) {
+		t.Errorf("got %d hybrid results, want the whole catalog", len(hybrid))
+	}
+	if got := productNames(hybrid[:len(keyword)]); !reflect.DeepEqual(got, productNames(keyword)) {
+		t.Errorf("hybrid at alpha 0 starts %v, want the keyword ranking %v", got, productNames(keyword))
+	}
+
+	limited, err := s.Hybrid(ctx, "macbook laptop", 0.5, SearchOptions{Limit: 2, Filters: &SearchFilters{Category: "laptops"}})
+	if err != nil {
+		t.Fatalf("Hybrid: %v", err)
+	}
+	got := productNames(limited)
+	sort.Strings(got)
+	if want := []string{"Dell XPS 13", "MacBook Air"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filtered hybrid got %v, want %v", got, want)
+	}
+}
+
+func TestMemoryStoreCutoffs(t *testing.T) {
+	s := useMemoryStore(t, testCatalog()...)
+	ctx := context.Background()
+
+	all, err := s.NearText(ctx, "noise cancelling headphones", SearchOptions{})
+	if err != nil {
+		t.Fatalf("NearText: %v", err)
+	}
+	for i, p := range all {
+		r := p.Relevance
+		if r == nil || r.Distance == nil || r.Certainty == nil {
+			t.Fatalf("%s has relevance %+v, want distance and certainty", p.Name, r)
+		}
+		if got := distanceToCertainty(*r.Distance); got != *r.Certainty {
+			t.Errorf("%s: certainty %v does not match distance %v", p.Name, *r.Certainty, *r.Distance)
+		}
+		if i > 0 && *r.Distance < *all[i-1].Relevance.Distance {
+			t.Errorf("results not ordered by distance: %v", productNames(all))
+		}
+	}
+
+	// A cutoff between the second and third results keeps the first two,
+	// whether it is given as a distance or as a certainty.
+	between := (*all[1].Relevance.Distance + *all[2].Relevance.Distance) / 2
+	for _, opts := range []SearchOptions{
+		{MaxDistance: &between},
+		{MinCertainty: float64Ptr(distanceToCertainty(between))},
+		{MaxDistance: float64Ptr(2), MinCertainty: float64Ptr(distanceToCertainty(between))},
+	} {
+		results, err := s.NearText(ctx, "noise cancelling headphones", opts)
+		if err != nil {
+			t.Fatalf("NearText: %v", err)
+		}
+		if got, want := productNames(results), productNames(all[:2]); !reflect.DeepEqual(got, want) {
+			t.Errorf("cutoff %v: got %v, want %v", between, got, want)
+		}
+	}
+}
+
+func TestMemoryStoreListCursor(t *testing.T) {
+	catalog := testCatalog()
+	s := useMemoryStore(t, catalog...)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{"one per page", 1},
+		{"uneven pages", 2},
+		{"exact page", 5},
+		{"larger than catalog", 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Product
+			opts := ListOptions{Limit: tt.limit}
+			for pages := 0; ; pages++ {
+				if pages > len(catalog) {
+					t.Fatal("cursor did not reach the end")
+				}
+				page, err := s.List(ctx, opts)
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				got = append(got, page...)
+				if len(page) < tt.limit {
+					break
+				}
+				// Round-trip the cursor the way listProducts hands it out.
+				cursor, err := decodeCursor(encodeCursor(pageCursor{After: page[len(page)-1].ID}))
+				if err != nil {
+					t.Fatalf("decodeCursor: %v", err)
+				}
+				opts.After = cursor.After
+			}
+			if !reflect.DeepEqual(productNames(got), productNames(catalog)) {
+				t.Errorf("got %v, want insertion order %v", productNames(got), productNames(catalog))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreListAfterUpdate(t *testing.T) {
+	catalog := testCatalog()
+	s := useMemoryStore(t, catalog...)
+	ctx := context.Background()
+
+	first, err := s.List(ctx, ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	// Rewriting a product already paged past keeps its place, so the next
+	// page neither repeats nor skips anything.
+	updated := first[0]
+	updated.Description = "Updated description"
+	if _, err := s.Upsert(ctx, []Product{updated}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	rest, err := s.List(ctx, ListOptions{Limit: 10, After: first[1].ID})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	got := productNames(append(first, rest...))
+	if !reflect.DeepEqual(got, productNames(catalog)) {
+		t.Errorf("got %v, want %v", got, productNames(catalog))
+	}
+}
@@ -0,0 +1,750 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/auth"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/fault"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+type weaviateStore struct {
+	client *weaviate.Client
+
+	// className is the class queries go to and embedder the model its
+	// vectors came from. A reindex switches both together while requests
+	// are being served.
+	mu        sync.RWMutex
+	className string
+	embedder  Embedder
+	// switching is held by a reindex or rollback for its whole run.
+	switching sync.Mutex
+	// writes is held shared by every write and exclusively by a reindex
+	// while it copies the last changes and switches classes, so no write
+	// can reach the old class after it was read for the last time.
+	writes sync.RWMutex
+	// written collects the IDs of products written while a reindex
+	// verifies its copy, so its final pass only has to copy those. It is
+	// nil while nothing is tracking writes.
+	writtenMu sync.Mutex
+	written   map[string]bool
+}
+
+func newWeaviateStore(embedder Embedder) *weaviateStore {
+	cfg := weaviate.Config{
+		Host:   getEnv("WEAVIATE_HOST", "localhost:8080"),
+		Scheme: "http",
+	}
+
+	if apiKey := os.Getenv("WEAVIATE_API_KEY"); apiKey != "" {
+		cfg.AuthConfig = auth.ApiKey{Value: apiKey}
+	}
+
+	return &weaviateStore{
+		client:    weaviate.New(cfg),
+		embedder:  embedder,
+		className: productAlias,
+	}
+}
+
+func (s *weaviateStore) class() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.className
+}
+
+// active returns the class and its embedder as one consistent pair.
+func (s *weaviateStore) active() (string, Embedder) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.className, s.embedder
+}
+
+func (s *weaviateStore) activate(className string, embedder Embedder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.className = className
+	s.embedder = embedder
+}
+
+// forClass returns a store for another class sharing the same client.
+func (s *weaviateStore) forClass(className string, embedder Embedder) *weaviateStore {
+	return &weaviateStore{client: s.client, className: className, embedder: embedder}
+}
+
+var productFields = append([]graphql.Field{
+	{Name: "sku"},
+	{Name: "name"},
+	{Name: "description"},
+	{Name: "category"},
+	{Name: "category_path"},
+	{Name: "brand"},
+	{Name: "price"},
+	{Name: "currency"},
+	{Name: "in_stock"},
+	{Name: "url"},
+	{Name: "image_url"},
+	{Name: "tags"},
+	{Name: "attributes"},
+	{Name: "created_at"},
+	{Name: "updated_at"},
+	{Name: "content_hash"},
+	{Name: "source_hash"},
+}, specFields()...)
+
+func specFields() []graphql.Field {
+	fields := make([]graphql.Field, len(specDefinitions))
+	for i, def := range specDefinitions {
+		fields[i] = graphql.Field{Name: def.Name}
+	}
+	return fields
+}
+
+// Additional fields requested per search mode. Weaviate only computes
+// distance and certainty for vector searches, and score for BM25 and hybrid.
+var (
+	vectorAdditional  = []string{"id", "distance", "certainty"}
+	keywordAdditional = []string{"id", "score", "explainScore"}
+)
+
+func resultFields(additional []string) []graphql.Field {
+	additionalFields := make([]graphql.Field, 0, len(additional))
+	for _, name := range additional {
+		additionalFields = append(additionalFields, graphql.Field{Name: name})
+	}
+
+	fields := append([]graphql.Field{}, productFields...)
+	return append(fields, graphql.Field{Name: "_additional", Fields: additionalFields})
+}
+
+// EnsureSchema points the store at the class the alias names, then creates
+// that class from productSchema or migrates it towards it.
+func (s *weaviateStore) EnsureSchema(ctx context.Context) error {
+	if err := s.ensureMetaClass(ctx); err != nil {
+		return err
+	}
+
+	target, err := s.getMeta(ctx, aliasKey)
+	if err != nil {
+		return err
+	}
+	if target != "" {
+		log.Printf("Alias %s points to class %s", productAlias, target)
+		s.activate(target, s.embedder)
+	}
+	className := s.class()
+
+	exists, err := s.client.Schema().ClassExistenceChecker().WithClassName(className).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("checking class existence: %w", err)
+	}
+
+	if !exists {
+		if err := s.client.Schema().ClassCreator().WithClass(productSchema(className)).Do(ctx); err != nil {
+			return fmt.Errorf("creating schema: %w", err)
+		}
+		if err := s.setSchemaVersion(ctx, schemaVersion); err != nil {
+			return err
+		}
+		log.Printf("Schema created successfully")
+	} else {
+		log.Printf("Class %s already exists", className)
+		if err := s.migrateSchema(ctx); err != nil {
+			return err
+		}
+	}
+
+	return s.useRecordedEmbedder(ctx)
+}
+
+// useRecordedEmbedder makes sure queries are embedded with the model that
+// produced the class's vectors. A class remembers its embedder, so changing
+// EMBEDDER only takes effect through a reindex.
+func (s *weaviateStore) useRecordedEmbedder(ctx context.Context) error {
+	className := s.class()
+	configured := embedderConfigFromEnv()
+
+	recorded, ok, err := s.embedderConfig(ctx, className)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		recorded, err = s.unrecordedEmbedder(ctx, className, configured)
+		if err != nil {
+			return err
+		}
+		if err := s.setEmbedderConfig(ctx, className, recorded); err != nil {
+			return err
+		}
+	}
+	if recorded != configured {
+		log.Printf("Class %s was indexed with %s embeddings, not the configured %s; using %s until a reindex", className, recorded, configured, recorded)
+		s.activate(className, newEmbedderFromConfig(recorded))
+	}
+	return nil
+}
+
+// unrecordedEmbedder works out the embedder of a class that has none
+// recorded. Classes created before embedders were recorded were vectorized
+// by Weaviate's text2vec-openai module, so their vectors come from the
+// OpenAI model in the module config rather than from the configured embedder.
+func (s *weaviateStore) unrecordedEmbedder(ctx context.Context, className string, configured EmbedderConfig) (EmbedderConfig, error) {
+	live, err := s.client.Schema().ClassGetter().WithClassName(className).Do(ctx)
+	if err != nil {
+		return EmbedderConfig{}, fmt.Errorf("reading class %s: %w", className, err)
+	}
+
+	switch live.Vectorizer {
+	case "", "none":
+		return configured, nil
+	case "text2vec-openai":
+		model := openAIModuleModel(live.ModuleConfig)
+		if model == "" {
+			break
+		}
+		legacy := EmbedderConfig{Kind: "openai", Model: model}
+		log.Printf("Class %s was vectorized by text2vec-openai with %s; recording that as its embedder", className, legacy.Model)
+		return legacy, nil
+	}
+	return EmbedderConfig{}, fmt.Errorf("class %s was vectorized by %s with settings no embedder matches; reindex it into a new class", className, live.Vectorizer)
+}
+
+// openAIModuleModel returns the OpenAI model named in a text2vec-openai
+// module config, or "" for the older models the embeddings API no longer
+// serves. Weaviate 1.24, the version this service first ran on, defaulted to
+// ada-002.
+func openAIModuleModel(moduleConfig interface{}) string {
+	settings, _ := moduleConfig.(map[string]interface{})
+	config, _ := settings["text2vec-openai"].(map[string]interface{})
+	model, _ := config["model"].(string)
+	version, _ := config["modelVersion"].(string)
+	switch {
+	case strings.HasPrefix(model, "text-embedding-"):
+		return model
+	case model == "" || model == "ada" && (version == "" || version == "002"):
+		return "text-embedding-ada-002"
+	}
+	return ""
+}
+
+// trackWrites starts recording the IDs of written products. Taking the write
+// lock waits for writes in flight, so every write that is not recorded
+// landed before tracking started.
+func (s *weaviateStore) trackWrites() {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	s.writtenMu.Lock()
+	defer s.writtenMu.Unlock()
+	s.written = map[string]bool{}
+}
+
+// stopTrackingWrites stops recording and returns the IDs written since
+// trackWrites.
+func (s *weaviateStore) stopTrackingWrites() []string {
+	s.writtenMu.Lock()
+	defer s.writtenMu.Unlock()
+	ids := make([]string, 0, len(s.written))
+	for id := range s.written {
+		ids = append(ids, id)
+	}
+	s.written = nil
+	return ids
+}
+
+// recordWrite notes a product about to be written. Writes are recorded
+// before they are sent, so a product is never in the store unrecorded.
+func (s *weaviateStore) recordWrite(id string) {
+	s.writtenMu.Lock()
+	defer s.writtenMu.Unlock()
+	if s.written != nil {
+		s.written[id] = true
+	}
+}
+
+func (s *weaviateStore) wasWritten(id string) bool {
+	s.writtenMu.Lock()
+	defer s.writtenMu.Unlock()
+	return s.written[id]
+}
+
+func (s *weaviateStore) Upsert(ctx context.Context, products []Product) ([]ObjectError, error) {
+	if len(products) == 0 {
+		return nil, nil
+	}
+
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	className, embedder := s.active()
+	vectors, err := embedProducts(ctx, embedder, products)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(products))
+	batcher := s.client.Batch().ObjectsBatcher()
+	for i, product := range products {
+		obj := &models.Object{
+			Class:      className,
+			Properties: productProperties(product),
+			Vector:     vectors[i],
+		}
+		// Objects are keyed by the product ID so writing the same product
+		// twice replaces it rather than adding a duplicate.
+		id := product.ID
+		if id == "" {
+			id = productID(product)
+		}
+		obj.ID = strfmt.UUID(id)
+		names[id] = product.Name
+		batcher = batcher.WithObject(obj)
+	}
+	for id := range names {
+		s.recordWrite(id)
+	}
+
+	responses, err := batcher.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A successful batch request can still contain failed objects.
+	var objectErrors []ObjectError
+	for _, response := range responses {
+		if response.Result == nil || response.Result.Errors == nil {
+			continue
+		}
+		messages := []string{}
+		for _, item := range response.Result.Errors.Error {
+			messages = append(messages, item.Message)
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		id := response.ID.String()
+		objectErrors = append(objectErrors, ObjectError{
+			ID:      id,
+			Name:    names[id],
+			Message: strings.Join(messages, "; "),
+		})
+	}
+	return objectErrors, nil
+}
+
+func (s *weaviateStore) Get(ctx context.Context, id string) (Product, error) {
+	if !strfmt.IsUUID(id) {
+		return Product{}, errNotFound
+	}
+
+	objects, err := s.client.Data().ObjectsGetter().
+		WithClassName(s.class()).
+		WithID(id).
+		Do(ctx)
+	if err != nil {
+		return Product{}, notFoundOr(err)
+	}
+	if len(objects) == 0 {
+		return Product{}, errNotFound
+	}
+	return productFromObject(objects[0]), nil
+}
+
+func (s *weaviateStore) GetMany(ctx context.Context, ids []string) (map[string]Product, error) {
+	operands := []*filters.WhereBuilder{}
+	for _, id := range ids {
+		if strfmt.IsUUID(id) {
+			operands = append(operands, filters.Where().
+				WithPath([]string{"id"}).
+				WithOperator(filters.Equal).
+				WithValueText(id))
+		}
+	}
+	products := make(map[string]Product, len(operands))
+	if len(operands) == 0 {
+		return products, nil
+	}
+
+	where := operands[0]
+	if len(operands) > 1 {
+		where = filters.Where().WithOperator(filters.Or).WithOperands(operands)
+	}
+
+	className := s.class()
+	result, err := s.client.GraphQL().Get().
+		WithClassName(className).
+		WithFields(resultFields([]string{"id"})...).
+		WithWhere(where).
+		WithLimit(len(operands)).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found, err := productsFromResult(result, className)
+	if err != nil {
+		return nil, err
+	}
+	for _, product := range found {
+		product.Relevance = nil
+		products[product.ID] = product
+	}
+	return products, nil
+}
+
+func (s *weaviateStore) GetVector(ctx context.Context, id string) ([]float32, error) {
+	if !strfmt.IsUUID(id) {
+		return nil, errNotFound
+	}
+
+	objects, err := s.client.Data().ObjectsGetter().
+		WithClassName(s.class()).
+		WithID(id).
+		WithVector().
+		Do(ctx)
+	if err != nil {
+		return nil, notFoundOr(err)
+	}
+	if len(objects) == 0 {
+		return nil, errNotFound
+	}
+	return objects[0].Vector, nil
+}
+
+func (s *weaviateStore) List(ctx context.Context, opts ListOptions) ([]Product, error) {
+	getter := s.client.Data().ObjectsGetter().
+		WithClassName(s.class()).
+		WithLimit(opts.Limit)
+	// Weaviate rejects after combined with offset.
+	if opts.After != "" {
+		getter = getter.WithAfter(opts.After)
+	} else {
+		getter = getter.WithOffset(opts.Offset)
+	}
+
+	objects, err := getter.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]Product, 0, len(objects))
+	for _, obj := range objects {
+		products = append(products, productFromObject(obj))
+	}
+	return products, nil
+}
+
+func (s *weaviateStore) Delete(ctx context.Context, id string) error {
+	if !strfmt.IsUUID(id) {
+		return errNotFound
+	}
+
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	s.recordWrite(id)
+	err := s.client.Data().Deleter().WithClassName(s.class()).WithID(id).Do(ctx)
+	return notFoundOr(err)
+}
+
+func (s *weaviateStore) NearText(ctx context.Context, query string, opts SearchOptions) ([]Product, error) {
+	className, embedder := s.active()
+	vector, err := embedOne(ctx, embedder, query)
+	if err != nil {
+		return nil, err
+	}
+	return s.nearVector(ctx, className, vector, opts)
+}
+
+func (s *weaviateStore) NearVector(ctx context.Context, vector []float32, opts SearchOptions) ([]Product, error) {
+	return s.nearVector(ctx, s.class(), vector, opts)
+}
+
+func (s *weaviateStore) nearVector(ctx context.Context, className string, vector []float32, opts SearchOptions) ([]Product, error) {
+	nearVector := s.client.GraphQL().NearVectorArgBuilder().
+		WithVector(vector)
+	if cutoff, ok := opts.distanceCutoff(); ok {
+		nearVector = nearVector.WithDistance(float32(cutoff))
+	}
+
+	return s.search(ctx, className, s.getBuilder(className, opts, vectorAdditional).WithNearVector(nearVector))
+}
+
+func (s *weaviateStore) NearObject(ctx context.Context, id string, opts SearchOptions) ([]Product, error) {
+	if !strfmt.IsUUID(id) {
+		return nil, errNotFound
+	}
+
+	nearObject := s.client.GraphQL().NearObjectArgBuilder().
+		WithID(id)
+	if cutoff, ok := opts.distanceCutoff(); ok {
+		nearObject = nearObject.WithDistance(float32(cutoff))
+	}
+
+	className := s.class()
+	return s.search(ctx, className, s.getBuilder(className, opts, vectorAdditional).WithNearObject(nearObject))
+}
+
+// keywordProperties are the properties BM25 searches, with the SKU and name
+// boosted so exact model numbers rank first.
+var keywordProperties = []string{"sku^3", "name^2", "brand", "description"}
+
+func (s *weaviateStore) Keyword(ctx context.Context, query string, opts SearchOptions) ([]Product, error) {
+	bm25 := s.client.GraphQL().Bm25ArgBuilder().
+		WithQuery(query).
+		WithProperties(keywordProperties...)
+
+	className := s.class()
+	return s.search(ctx, className, s.getBuilder(className, opts, keywordAdditional).WithBM25(bm25))
+}
+
+func (s *weaviateStore) Hybrid(ctx context.Context, query string, alpha float32, opts SearchOptions) ([]Product, error) {
+	className, embedder := s.active()
+	vector, err := embedOne(ctx, embedder, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// The class has no vectorizer, so the query vector has to be supplied.
+	hybrid := s.client.GraphQL().HybridArgumentBuilder().
+		WithQuery(query).
+		WithVector(vector).
+		WithAlpha(alpha).
+		WithProperties(keywordProperties)
+
+	return s.search(ctx, className, s.getBuilder(className, opts, keywordAdditional).WithHybrid(hybrid))
+}
+
+// getBuilder starts a Get query with the options shared by every search mode.
+func (s *weaviateStore) getBuilder(className string, opts SearchOptions, additional []string) *graphql.GetBuilder {
+	get := s.client.GraphQL().Get().
+		WithClassName(className).
+		WithFields(resultFields(additional)...).
+		WithLimit(opts.Limit).
+		WithOffset(opts.Offset)
+	if where := whereFromFilters(opts.Filters, opts.ExcludeIDs); where != nil {
+		get = get.WithWhere(where)
+	}
+	return get
+}
+
+// search runs a Get query against className. The class is passed in rather
+// than read again so a concurrent reindex cannot switch it between building
+// the query and reading the result.
+func (s *weaviateStore) search(ctx context.Context, className string, get *graphql.GetBuilder) ([]Product, error) {
+	result, err := get.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return productsFromResult(result, className)
+}
+
+func (s *weaviateStore) Count(ctx context.Context, filters *SearchFilters) (int, error) {
+	className := s.class()
+	aggregate := s.client.GraphQL().Aggregate().
+		WithClassName(className).
+		WithFields(graphql.Field{Name: "meta", Fields: []graphql.Field{{Name: "count"}}})
+	if where := whereFromFilters(filters, nil); where != nil {
+		aggregate = aggregate.WithWhere(where)
+	}
+
+	result, err := aggregate.Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := graphQLError(result); err != nil {
+		return 0, err
+	}
+
+	if data, ok := result.Data["Aggregate"].(map[string]interface{}); ok {
+		if products, ok := data[className].([]interface{}); ok && len(products) > 0 {
+			if product, ok := products[0].(map[string]interface{}); ok {
+				if meta, ok := product["meta"].(map[string]interface{}); ok {
+					if count, ok := meta["count"].(float64); ok {
+						return int(count), nil
+					}
+				}
+			}
+		}
+	}
+	return 0, nil
+}
+
+func productsFromResult(result *models.GraphQLResponse, className string) ([]Product, error) {
+	if err := graphQLError(result); err != nil {
+		return nil, err
+	}
+
+	products := []Product{}
+	if data, ok := result.Data["Get"].(map[string]interface{}); ok {
+		if productData, ok := data[className].([]interface{}); ok {
+			for _, item := range productData {
+				if productMap, ok := item.(map[string]interface{}); ok {
+					additional, _ := productMap["_additional"].(map[string]interface{})
+					product := productFromProperties(getString(additional, "id"), productMap)
+					product.Relevance = relevanceFromAdditional(additional)
+					products = append(products, product)
+				}
+			}
+		}
+	}
+	return products, nil
+}
+
+func relevanceFromAdditional(additional map[string]interface{}) *Relevance {
+	relevance := &Relevance{ExplainScore: getString(additional, "explainScore")}
+	if distance, ok := additional["distance"].(float64); ok {
+		relevance.Distance = &distance
+	}
+	if certainty, ok := additional["certainty"].(float64); ok {
+		relevance.Certainty = &certainty
+	}
+	// GraphQL returns BM25 and hybrid scores as strings.
+	if score, err := strconv.ParseFloat(getString(additional, "score"), 64); err == nil {
+		relevance.Score = &score
+	}
+
+	if relevance.Distance == nil && relevance.Certainty == nil && relevance.Score == nil && relevance.ExplainScore == "" {
+		return nil
+	}
+	return relevance
+}
+
+// whereFromFilters translates search filters and excluded object IDs into a
+// Weaviate where clause. Filters are expected to have been validated already.
+func whereFromFilters(f *SearchFilters, exclude []string) *filters.WhereBuilder {
+	operands := []*filters.WhereBuilder{}
+	for _, id := range exclude {
+		operands = append(operands, filters.Where().
+			WithPath([]string{"id"}).
+			WithOperator(filters.NotEqual).
+			WithValueText(id))
+	}
+	if f == nil {
+		f = &SearchFilters{}
+	}
+
+	if f.Category != "" {
+		operands = append(operands, whereCategory(f.Category))
+	}
+	if len(f.Categories) > 0 {
+		operands = append(operands, whereCategory(f.Categories...))
+	}
+	for _, pf := range f.Properties {
+		operands = append(operands, whereFromPropertyFilter(pf))
+	}
+
+	if len(operands) == 0 {
+		return nil
+	}
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return filters.Where().WithOperator(filters.And).WithOperands(operands)
+}
+
+// whereCategory matches products in any of the categories or below them in
+// the taxonomy. Objects written before category_path existed still match on
+// their own category.
+func whereCategory(categories ...string) *filters.WhereBuilder {
+	lower := make([]string, len(categories))
+	for i, category := range categories {
+		lower[i] = strings.ToLower(category)
+	}
+	return filters.Where().WithOperator(filters.Or).WithOperands([]*filters.WhereBuilder{
+		filters.Where().
+			WithPath([]string{"category_path"}).
+			WithOperator(filters.ContainsAny).
+			WithValueText(lower...),
+		filters.Where().
+			WithPath([]string{"category"}).
+			WithOperator(filters.ContainsAny).
+			WithValueText(categories...),
+	})
+}
+
+func whereFromPropertyFilter(pf PropertyFilter) *filters.WhereBuilder {
+	dataType := propertyTypes[pf.Property]
+	where := filters.Where().WithPath([]string{pf.Property})
+
+	switch pf.Operator {
+	case "equals", "not_equals":
+		operator := filters.Equal
+		if pf.Operator == "not_equals" {
+			operator = filters.NotEqual
+		}
+		return withFilterValue(where.WithOperator(operator), dataType, pf.Value)
+	case "contains":
+		value, _ := pf.Value.(string)
+		if dataType == "text[]" {
+			return where.WithOperator(filters.ContainsAny).WithValueText(value)
+		}
+		return where.WithOperator(filters.Like).WithValueText("*" + value + "*")
+	case "range":
+		bounds := []*filters.WhereBuilder{}
+		if pf.Min != nil {
+			bounds = append(bounds, filters.Where().
+				WithPath([]string{pf.Property}).
+				WithOperator(filters.GreaterThanEqual).
+				WithValueNumber(*pf.Min))
+		}
+		if pf.Max != nil {
+			bounds = append(bounds, filters.Where().
+				WithPath([]string{pf.Property}).
+				WithOperator(filters.LessThanEqual).
+				WithValueNumber(*pf.Max))
+		}
+		if len(bounds) == 1 {
+			return bounds[0]
+		}
+		return filters.Where().WithOperator(filters.And).WithOperands(bounds)
+	}
+	return where
+}
+
+func withFilterValue(where *filters.WhereBuilder, dataType string, value interface{}) *filters.WhereBuilder {
+	switch v := value.(type) {
+	case string:
+		return where.WithValueText(v)
+	case bool:
+		return where.WithValueBoolean(v)
+	case float64:
+		if dataType == "int" {
+			return where.WithValueInt(int64(v))
+		}
+		return where.WithValueNumber(v)
+	}
+	return where
+}
+
+func productFromObject(obj *models.Object) Product {
+	props, _ := obj.Properties.(map[string]interface{})
+	return productFromProperties(obj.ID.String(), props)
+}
+
+// notFoundOr maps Weaviate's 404 responses onto errNotFound.
+func notFoundOr(err error) error {
+	var clientErr *fault.WeaviateClientError
+	if errors.As(err, &clientErr) && clientErr.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	return err
+}
+
+// graphQLError surfaces errors Weaviate reports inside a 200 GraphQL response.
+func graphQLError(result *models.GraphQLResponse) error {
+	if result == nil || len(result.Errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("graphql: %s", result.Errors[0].Message)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// syncPageSize is how many products are read per page when loading the
+// current state of the index.
+const syncPageSize = 500
+
+// SyncSummary reports what a catalog sync changed.
+type SyncSummary struct {
+	Unchanged int `json:"unchanged"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	// Migrated counts objects stored under an ID from before product IDs
+	// were derived from the SKU or name, replaced by their derived ID.
+	Migrated int           `json:"migrated"`
+	Failed   int           `json:"failed"`
+	Errors   []ObjectError `json:"errors"`
+}
+
+// syncCatalog makes the index converge on products: new and changed products
+// are written, unchanged ones are skipped by comparing content hashes, and
+// with deleteMissing, indexed products absent from the source are removed.
+// Only records whose source hash changed are categorized and have their specs
+// extracted, so a restart with an unchanged catalog makes no model calls.
+func syncCatalog(ctx context.Context, products []Product, deleteMissing bool) (SyncSummary, error) {
+	summary := SyncSummary{Errors: []ObjectError{}}
+
+	existing, err := indexedProducts(ctx, store)
+	if err != nil {
+		return summary, fmt.Errorf("reading current index: %w", err)
+	}
+
+	// Objects written before IDs were derived from the SKU or name have
+	// random UUIDs. Each stands in for its derived ID until that is written,
+	// and is then deleted, so the first sync does not duplicate the catalog.
+	legacy := map[string]string{}
+	for id, stored := range existing {
+		derived := productID(stored)
+		if derived == id {
+			continue
+		}
+		if _, ok := existing[derived]; ok {
+			continue
+		}
+		legacy[derived] = id
+	}
+	for derived, id := range legacy {
+		existing[derived] = existing[id]
+	}
+
+	// Later duplicates win, as they would if written one after another.
+	source := make(map[string]Product, len(products))
+	order := []string{}
+	for _, product := range products {
+		id := productKey(product)
+		product.ID = id
+		if _, seen := source[id]; !seen {
+			order = append(order, id)
+		}
+		source[id] = product
+	}
+
+	changed := []Product{}
+	created := map[string]bool{}
+	for _, id := range order {
+		product := source[id]
+		stored, indexed := existing[id]
+		completeProduct(ctx, &product, stored, indexed)
+		switch {
+		case !indexed || legacy[id] != "":
+			created[id] = true
+			changed = append(changed, product)
+		case stored.ContentHash != contentHash(product) || stored.SourceHash != product.SourceHash:
+			changed = append(changed, product)
+		default:
+			summary.Unchanged++
+		}
+	}
+
+	written := newBatchWriter().write(ctx, changed, nil)
+	failed := map[string]bool{}
+	for _, objectError := range written.Errors {
+		failed[objectError.ID] = true
+	}
+	for _, product := range changed {
+		switch {
+		case failed[product.ID]:
+		case created[product.ID]:
+			summary.Created++
+		default:
+			summary.Updated++
+		}
+	}
+	summary.Failed += written.Failed
+	summary.Errors = append(summary.Errors, written.Errors...)
+
+	for derived, id := range legacy {
+		delete(existing, derived)
+		if _, ok := source[derived]; !ok || failed[derived] {
+			continue
+		}
+		if err := store.Delete(ctx, id); err != nil {
+			summary.Failed++
+			summary.Errors = append(summary.Errors, ObjectError{ID: id, Message: "delete migrated object: " + err.Error()})
+			continue
+		}
+		delete(existing, id)
+		summary.Migrated++
+	}
+
+	if deleteMissing {
+		for id := range existing {
+			if _, ok := source[id]; ok {
+				continue
+			}
+			if err := store.Delete(ctx, id); err != nil {
+				summary.Failed++
+				summary.Errors = append(summary.Errors, ObjectError{ID: id, Message: "delete: " + err.Error()})
+				continue
+			}
+			summary.Deleted++
+		}
+	}
+
+	return summary, nil
+}
+
+// completeProduct fills in what the catalog record left out of p: the
+// category, brand and specs. When the record is unchanged since the stored
+// product was synced from it, they are copied from stored, which costs no
+// categorizer or extractor calls; otherwise the brand and specs are inferred
+// again and the stored category is kept.
+func completeProduct(ctx context.Context, p *Product, stored Product, indexed bool) {
+	if indexed && stored.SourceHash != "" && stored.SourceHash == p.SourceHash {
+		if p.Category == "" {
+			p.Category = stored.Category
+		}
+		if p.Brand == "" {
+			p.Brand = stored.Brand
+		}
+		for name, value := range stored.Specs {
+			if _, ok := p.Specs[name]; ok {
+				continue
+			}
+			if p.Specs == nil {
+				p.Specs = map[string]interface{}{}
+			}
+			p.Specs[name] = value
+		}
+		return
+	}
+
+	// A stored category was inferred before or set since, by a reviewer or
+	// an API edit; either way it stays until the record names one.
+	if p.Category == "" && indexed {
+		p.Category = stored.Category
+	}
+	if p.Category == "" {
+		p.Category = categorizeProduct(ctx, *p).Category
+	}
+	if p.Brand == "" {
+		p.Brand = brandFromName(p.Name)
+	}
+	applySpecs(p)
+}
+
+// completeProducts runs completeProduct over products, reading the stored
+// versions a page at a time.
+func completeProducts(ctx context.Context, products []Product) error {
+	for start := 0; start < len(products); start += syncPageSize {
+		end := start + syncPageSize
+		if end > len(products) {
+			end = len(products)
+		}
+		page := products[start:end]
+
+		ids := make([]string, len(page))
+		for i, product := range page {
+			ids[i] = productKey(product)
+		}
+		existing, err := store.GetMany(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("reading existing products: %w", err)
+		}
+		for i := range page {
+			stored, indexed := existing[ids[i]]
+			completeProduct(ctx, &page[i], stored, indexed)
+		}
+	}
+	return nil
+}
+
+// indexedProducts pages through the whole of target and returns every
+// product by ID.
+func indexedProducts(ctx context.Context, target VectorStore) (map[string]Product, error) {
+	products := map[string]Product{}
+	after := ""
+	for {
+		page, err := target.List(ctx, ListOptions{Limit: syncPageSize, After: after})
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range page {
+			products[product.ID] = product
+		}
+		if len(page) < syncPageSize {
+			return products, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// indexedHashes returns the content hash of every product in target by ID.
+func indexedHashes(ctx context.Context, target VectorStore) (map[string]string, error) {
+	products, err := indexedProducts(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(products))
+	for id, product := range products {
+		hashes[id] = product.ContentHash
+	}
+	return hashes, nil
+}
+
+func logSyncSummary(source string, summary SyncSummary) {
+	for _, objectError := range summary.Errors {
+		log.Printf("Failed to sync product %s (%s): %s", objectError.ID, objectError.Name, objectError.Message)
+	}
+	log.Printf("Synced %s: %d created, %d updated, %d unchanged, %d deleted, %d migrated, %d failed",
+		source, summary.Created, summary.Updated, summary.Unchanged, summary.Deleted, summary.Migrated, summary.Failed)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countingCategorizer puts everything in one category and counts its calls.
+type countingCategorizer struct {
+	category string
+	calls    int
+}
+
+func (c *countingCategorizer) Categorize(ctx context.Context, p Product) (Categorization, error) {
+	c.calls++
+	return Categorization{Category: c.category, Confidence: 1, Source: "test"}, nil
+}
+
+func useCategorizer(t *testing.T, c Categorizer) {
+	t.Helper()
+	previous := categorizer
+	categorizer = c
+	t.Cleanup(func() { categorizer = previous })
+}
+
+func parseTestCatalog(t *testing.T, jsonl string) []Product {
+	t.Helper()
+	result, err := parseJSONL(strings.NewReader(jsonl))
+	if err != nil || len(result.Errors) > 0 {
+		t.Fatalf("parseJSONL: %v %v", err, result.Errors)
+	}
+	return result.Products
+}
+
+func TestSyncCatalog(t *testing.T) {
+	const catalog = `{"name": "Dell XPS 13", "description": "13 inch laptop with 16GB RAM"}
+{"name": "Sony WH-1000XM5", "description": "Noise cancelling headphones"}
+{"name": "JBL Flip 6", "description": "Portable speaker", "category": "speakers"}`
+	const edited = `{"name": "Dell XPS 13", "description": "13 inch laptop with 32GB RAM"}
+{"name": "Sony WH-1000XM5", "description": "Noise cancelling headphones"}`
+
+	tests := []struct {
+		name          string
+		catalog       string
+		deleteMissing bool
+		want          SyncSummary
+		// calls is how many products the categorizer sees.
+		calls int
+	}{
+		{"first sync", catalog, false, SyncSummary{Created: 3}, 2},
+		{"unchanged catalog", catalog, false, SyncSummary{Unchanged: 3}, 0},
+		{"edited record keeps its category", edited, false, SyncSummary{Updated: 1, Unchanged: 1}, 0},
+		{"missing products are kept", edited, false, SyncSummary{Unchanged: 2}, 0},
+		{"missing products are deleted", edited, true, SyncSummary{Unchanged: 2, Deleted: 1}, 0},
+	}
+
+	s := useMemoryStore(t)
+	c := &countingCategorizer{category: "gaming"}
+	useCategorizer(t, c)
+
+	// The steps build on each other, so they run in order.
+	for _, tt := range tests {
+		c.calls = 0
+		summary, err := syncCatalog(context.Background(), parseTestCatalog(t, tt.catalog), tt.deleteMissing)
+		if err != nil {
+			t.Fatalf("%s: syncCatalog: %v", tt.name, err)
+		}
+		if len(summary.Errors) > 0 {
+			t.Errorf("%s: errors %v", tt.name, summary.Errors)
+		}
+		summary.Errors = nil
+		if !reflect.DeepEqual(summary, tt.want) {
+			t.Errorf("%s: summary %+v, want %+v", tt.name, summary, tt.want)
+		}
+		if c.calls != tt.calls {
+			t.Errorf("%s: categorizer called %d times, want %d", tt.name, c.calls, tt.calls)
+		}
+	}
+
+	dell, err := s.Get(context.Background(), productID(Product{Name: "Dell XPS 13"}))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if dell.Category != "gaming" || dell.Brand != "Dell" || dell.Specs["ram_gb"] != 32.0 {
+		t.Errorf("got category %q, brand %q and specs %v, want the first category with the brand and specs of the edit", dell.Category, dell.Brand, dell.Specs)
+	}
+}
+
+func TestSyncCatalogKeepsReviewedCategory(t *testing.T) {
+	s := useMemoryStore(t)
+	useCategorizer(t, &countingCategorizer{category: "gaming"})
+	ctx := context.Background()
+
+	products := parseTestCatalog(t, `{"name": "Steam Deck", "description": "Handheld PC"}`)
+	if _, err := syncCatalog(ctx, products, false); err != nil {
+		t.Fatalf("syncCatalog: %v", err)
+	}
+
+	// A reviewer or an API edit sets the category; the catalog has none.
+	stored, err := s.Get(ctx, products[0].ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	stored.Category = "laptops"
+	stored.SourceHash = ""
+	if err := upsertProduct(ctx, &stored); err != nil {
+		t.Fatalf("upsertProduct: %v", err)
+	}
+
+	for _, catalog := range []string{
+		`{"name": "Steam Deck", "description": "Handheld PC"}`,
+		`{"name": "Steam Deck", "description": "Handheld gaming PC"}`,
+	} {
+		if _, err := syncCatalog(ctx, parseTestCatalog(t, catalog), false); err != nil {
+			t.Fatalf("syncCatalog: %v", err)
+		}
+		got, err := s.Get(ctx, products[0].ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Category != "laptops" {
+			t.Errorf("after syncing %s the category is %q, want laptops", catalog, got.Category)
+		}
+	}
+}
+
+func TestSyncCatalogFailures(t *testing.T) {
+	s := &flakyStore{objectErrors: map[string][]string{"MacBook Air": {"invalid property"}}}
+	useFlakyStore(t, s)
+	ctx := context.Background()
+	catalog := `{"name": "Dell XPS 13", "category": "laptops"}
+{"name": "MacBook Air", "category": "laptops"}`
+
+	summary, err := syncCatalog(ctx, parseTestCatalog(t, catalog), false)
+	if err != nil {
+		t.Fatalf("syncCatalog: %v", err)
+	}
+	if summary.Created != 1 || summary.Failed != 1 || len(summary.Errors) != 1 || summary.Errors[0].Name != "MacBook Air" {
+		t.Errorf("first sync %+v, want one created and the MacBook failed", summary)
+	}
+
+	// A product that failed is not indexed, so the next sync creates it.
+	summary, err = syncCatalog(ctx, parseTestCatalog(t, catalog), false)
+	if err != nil {
+		t.Fatalf("syncCatalog: %v", err)
+	}
+	if summary.Created != 1 || summary.Unchanged != 1 || summary.Failed != 0 {
+		t.Errorf("second sync %+v, want one created and one unchanged", summary)
+	}
+}
+
+func TestSyncCatalogMigratesLegacyIDs(t *testing.T) {
+	// Products written before IDs were derived had random UUIDs.
+	legacy := Product{ID: "0b7e9c3a-5d1f-4a2e-8c6b-9f0a1e2d3c4b", Name: "MacBook Air", Description: "Thin laptop", Category: "laptops"}
+	s := useMemoryStore(t, legacy)
+	useCategorizer(t, &countingCategorizer{category: "gaming"})
+	ctx := context.Background()
+
+	catalog := `{"name": "MacBook Air", "description": "Thin laptop"}`
+	summary, err := syncCatalog(ctx, parseTestCatalog(t, catalog), false)
+	if err != nil {
+		t.Fatalf("syncCatalog: %v", err)
+	}
+	if summary.Created != 1 || summary.Migrated != 1 || summary.Deleted != 0 {
+		t.Errorf("first sync %+v, want one created and one migrated", summary)
+	}
+
+	if _, err := s.Get(ctx, legacy.ID); err != errNotFound {
+		t.Errorf("legacy object still there: %v", err)
+	}
+	migrated, err := s.Get(ctx, productID(legacy))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if migrated.Category != "laptops" {
+		t.Errorf("migrated category %q, want the legacy object's laptops", migrated.Category)
+	}
+
+	summary, err = syncCatalog(ctx, parseTestCatalog(t, catalog), false)
+	if err != nil {
+		t.Fatalf("syncCatalog: %v", err)
+	}
+	if summary.Unchanged != 1 || summary.Created+summary.Updated+summary.Migrated != 0 {
+		t.Errorf("second sync %+v, want one unchanged", summary)
+	}
+}
+
+func TestSyncCatalogKeepsExplicitIDs(t *testing.T) {
+	s := useMemoryStore(t)
+	useCategorizer(t, &countingCategorizer{category: "gaming"})
+	ctx := context.Background()
+
+	// An upper-case ID names the same object as its lower-case form, so
+	// deleting missing products must not remove what the sync just wrote.
+	catalog := `{"id": "7A1B2C3D-4E5F-4A6B-8C7D-9E0F1A2B3C4D", "name": "Steam Deck"}`
+	for _, want := range []SyncSummary{{Created: 1}, {Unchanged: 1}} {
+		summary, err := syncCatalog(ctx, parseTestCatalog(t, catalog), true)
+		if err != nil {
+			t.Fatalf("syncCatalog: %v", err)
+		}
+		summary.Errors = nil
+		if !reflect.DeepEqual(summary, want) {
+			t.Errorf("summary %+v, want %+v", summary, want)
+		}
+	}
+	if _, err := s.Get(ctx, "7a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"); err != nil {
+		t.Errorf("Get: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed taxonomy.yaml
+var defaultTaxonomy []byte
+
+// CategoryNode is one node of the category taxonomy.
+type CategoryNode struct {
+	Name     string          `yaml:"name"`
+	Children []*CategoryNode `yaml:"children"`
+}
+
+// UnmarshalYAML accepts a bare name for nodes without children.
+func (n *CategoryNode) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		n.Name = value.Value
+		return nil
+	}
+	type node CategoryNode
+	return value.Decode((*node)(n))
+}
+
+// Taxonomy is the category tree. Products store their most specific
+// category; the path from the root is looked up here.
+type Taxonomy struct {
+	roots []*CategoryNode
+	// paths maps each category to its path from the root, inclusive.
+	paths map[string][]string
+	// names lists every category, depth first.
+	names []string
+}
+
+var taxonomy = mustParseTaxonomy(defaultTaxonomy)
+
+func mustParseTaxonomy(data []byte) *Taxonomy {
+	t, err := parseTaxonomy(data)
+	if err != nil {
+		panic(fmt.Sprintf("built-in taxonomy: %v", err))
+	}
+	return t
+}
+
+// initTaxonomy replaces the built-in taxonomy with TAXONOMY_FILE, if set. It
+// runs before the categorizers are configured, since they pick from it.
+func initTaxonomy() {
+	path := os.Getenv("TAXONOMY_FILE")
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error loading taxonomy, using the built-in one: %v", err)
+		return
+	}
+	t, err := parseTaxonomy(data)
+	if err != nil {
+		log.Printf("Error loading taxonomy, using the built-in one: %s: %v", path, err)
+		return
+	}
+	taxonomy = t
+	productCategories = t.names
+	log.Printf("Loaded %d categories from %s", len(t.names), path)
+}
+
+func parseTaxonomy(data []byte) (*Taxonomy, error) {
+	var roots []*CategoryNode
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&roots); err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("no categories")
+	}
+
+	t := &Taxonomy{roots: roots, paths: map[string][]string{}}
+	var walk func(nodes []*CategoryNode, parent []string) error
+	walk = func(nodes []*CategoryNode, parent []string) error {
+		for _, node := range nodes {
+			node.Name = strings.ToLower(strings.TrimSpace(node.Name))
+			if node.Name == "" {
+				return errors.New("category with an empty name")
+			}
+			if _, ok := t.paths[node.Name]; ok {
+				return fmt.Errorf("category %q appears more than once", node.Name)
+			}
+			path := append(append([]string{}, parent...), node.Name)
+			t.paths[node.Name] = path
+			t.names = append(t.names, node.Name)
+			if err := walk(node.Children, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(roots, nil); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// path returns the path from the root to category. A category that is not in
+// the taxonomy is its own one-element path.
+func (t *Taxonomy) path(category string) []string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return nil
+	}
+	if path, ok := t.paths[category]; ok {
+		return path
+	}
+	return []string{category}
+}
+
+// related reports whether one category is the other or an ancestor of it.
+func (t *Taxonomy) related(a, b string) bool {
+	return containsString(t.path(a), strings.ToLower(b)) || containsString(t.path(b), strings.ToLower(a))
+}
+
+// CategoryCount is a taxonomy node with the number of products at or below
+// it.
+type CategoryCount struct {
+	Name     string          `json:"name"`
+	Path     []string        `json:"path"`
+	Count    int             `json:"count"`
+	Children []CategoryCount `json:"children,omitempty"`
+}
+
+// listCategories serves GET /categories: the taxonomy tree with product
+// counts, for building navigation.
+func listCategories(c *gin.Context) {
+	var count func(nodes []*CategoryNode) ([]CategoryCount, error)
+	count = func(nodes []*CategoryNode) ([]CategoryCount, error) {
+		counts := make([]CategoryCount, 0, len(nodes))
+		for _, node := range nodes {
+			n, err := store.Count(c.Request.Context(), &SearchFilters{Category: node.Name})
+			if err != nil {
+				return nil, err
+			}
+			children, err := count(node.Children)
+			if err != nil {
+				return nil, err
+			}
+			counts = append(counts, CategoryCount{
+				Name:     node.Name,
+				Path:     taxonomy.path(node.Name),
+				Count:    n,
+				Children: children,
+			})
+		}
+		return counts, nil
+	}
+
+	categories, err := count(taxonomy.roots)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total, err := store.Count(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories, "total": total})
+}
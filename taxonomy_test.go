@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTaxonomy(t *testing.T) {
+	tx, err := parseTaxonomy([]byte(`
+- name: Electronics
+  children:
+    - name: audio
+      children: [headphones, " Speakers "]
+    - laptops
+- fitness
+`))
+	if err != nil {
+		t.Fatalf("parseTaxonomy: %v", err)
+	}
+
+	wantNames := []string{"electronics", "audio", "headphones", "speakers", "laptops", "fitness"}
+	if !reflect.DeepEqual(tx.names, wantNames) {
+		t.Errorf("names %v, want %v", tx.names, wantNames)
+	}
+
+	paths := []struct {
+		category string
+		want     []string
+	}{
+		{"headphones", []string{"electronics", "audio", "headphones"}},
+		{"Speakers", []string{"electronics", "audio", "speakers"}},
+		{"fitness", []string{"fitness"}},
+		{"toys", []string{"toys"}},
+		{"", nil},
+	}
+	for _, tt := range paths {
+		if got := tx.path(tt.category); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("path(%q) = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+
+	if !tx.related("audio", "headphones") || !tx.related("Headphones", "electronics") {
+		t.Errorf("a category should be related to its ancestors")
+	}
+	if tx.related("headphones", "speakers") || tx.related("laptops", "fitness") {
+		t.Errorf("siblings and separate trees should not be related")
+	}
+}
+
+func TestParseTaxonomyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		taxonomy string
+		wantErr  string
+	}{
+		{"empty", "[]", "no categories"},
+		{"blank name", "- name: electronics\n  children: [' ']\n", "empty name"},
+		{"duplicate", "- name: audio\n  children: [speakers]\n- speakers\n", `"speakers" appears more than once`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTaxonomy([]byte(tt.taxonomy))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
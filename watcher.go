@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dirWatcher polls a directory for catalog files and ingests each one once it
+// has stopped changing. Processed files are moved to the archive directory,
+// files that failed or had rejected records to the quarantine directory.
+type dirWatcher struct {
+	dir        string
+	archive    string
+	quarantine string
+	interval   time.Duration
+	mapping    ColumnMapping
+	// seen is the size and modification time of each pending file at the
+	// previous poll.
+	seen map[string]fileState
+	// stuck holds files that were ingested but could not be moved, so they
+	// are not ingested again until they change.
+	stuck map[string]fileState
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// startDirWatcher starts watching WATCH_DIR in the background. It does
+// nothing when WATCH_DIR is unset.
+func startDirWatcher() {
+	dir := os.Getenv("WATCH_DIR")
+	if dir == "" {
+		return
+	}
+
+	interval, err := time.ParseDuration(getEnv("WATCH_INTERVAL", "10s"))
+	if err != nil || interval <= 0 {
+		log.Printf("Invalid WATCH_INTERVAL %q, using 10s", os.Getenv("WATCH_INTERVAL"))
+		interval = 10 * time.Second
+	}
+
+	mapping, err := parseColumnMapping(os.Getenv("CATALOG_CSV_MAPPING"))
+	if err != nil {
+		log.Printf("Not watching %s: %v", dir, err)
+		return
+	}
+
+	w := &dirWatcher{
+		dir:        dir,
+		archive:    getEnv("WATCH_ARCHIVE_DIR", filepath.Join(dir, "archive")),
+		quarantine: getEnv("WATCH_QUARANTINE_DIR", filepath.Join(dir, "quarantine")),
+		interval:   interval,
+		mapping:    mapping,
+		seen:       make(map[string]fileState),
+		stuck:      make(map[string]fileState),
+	}
+	for _, d := range []string{w.archive, w.quarantine} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			log.Printf("Not watching %s: %v", dir, err)
+			return
+		}
+	}
+
+	log.Printf("Watching %s for catalog files every %s", dir, interval)
+	go w.run()
+}
+
+func (w *dirWatcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll()
+		<-ticker.C
+	}
+}
+
+// poll ingests every catalog file whose size and modification time are the
+// same as at the previous poll, so files still being written are left alone.
+func (w *dirWatcher) poll() {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		log.Printf("Error reading %s: %v", w.dir, err)
+		return
+	}
+
+	current := make(map[string]fileState)
+	for _, entry := range entries {
+		name := entry.Name()
+		// Hidden files are usually partial uploads or editor swap files.
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if _, err := detectFormat(name); err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if w.stuck[name] == state {
+			continue
+		}
+		delete(w.stuck, name)
+		if previous, ok := w.seen[name]; !ok || previous != state {
+			current[name] = state
+			continue
+		}
+		if !w.process(name) {
+			w.stuck[name] = state
+		}
+	}
+	w.seen = current
+}
+
+// process ingests one file through an ingest job, so it shows up under
+// GET /ingest/jobs/:id like an upload, then moves it out of the directory.
+// It reports whether the file was moved.
+func (w *dirWatcher) process(name string) bool {
+	path := filepath.Join(w.dir, name)
+	format, _ := detectFormat(name)
+
+	jobID := createIngestJob("watch:"+name, format)
+	ingestFile(jobID, path, format, w.mapping)
+	job, _ := ingestJobs.get(jobID)
+
+	target := w.archive
+	if job.Status == jobFailed || job.Failed > 0 || job.Skipped > 0 {
+		target = w.quarantine
+	}
+
+	// A timestamp prefix keeps a later file with the same name from
+	// overwriting an earlier one.
+	stamped := time.Now().UTC().Format("20060102T150405Z") + "-" + name
+	if err := os.Rename(path, filepath.Join(target, stamped)); err != nil {
+		log.Printf("Error moving %s to %s: %v", path, target, err)
+		return false
+	}
+
+	if target == w.quarantine {
+		if err := writeJobReport(filepath.Join(target, stamped+".job.json"), job); err != nil {
+			log.Printf("Error writing report for %s: %v", stamped, err)
+		}
+		log.Printf("Quarantined %s (job %s)", name, jobID)
+		return true
+	}
+	log.Printf("Archived %s (job %s)", name, jobID)
+	return true
+}
+
+// writeJobReport saves the job next to a quarantined file so the cause of the
+// failure travels with it.
+func writeJobReport(path string, job IngestJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding job: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
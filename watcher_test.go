@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newTestWatcher(t *testing.T) *dirWatcher {
+	t.Helper()
+	dir := t.TempDir()
+	w := &dirWatcher{
+		dir:        dir,
+		archive:    filepath.Join(dir, "archive"),
+		quarantine: filepath.Join(dir, "quarantine"),
+		seen:       make(map[string]fileState),
+		stuck:      make(map[string]fileState),
+	}
+	for _, d := range []string{w.archive, w.quarantine} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dirNames lists a directory, dropping the timestamp prefix of moved files.
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if _, rest, ok := strings.Cut(name, "Z-"); ok {
+			name = rest
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDirWatcherPoll(t *testing.T) {
+	s := useMemoryStore(t)
+	w := newTestWatcher(t)
+
+	writeTestFile(t, filepath.Join(w.dir, "good.jsonl"), `{"name": "Dell XPS 13", "category": "laptops"}`+"\n")
+	writeTestFile(t, filepath.Join(w.dir, "bad.jsonl"), `{"name": "MacBook Air", "category": "laptops"}`+"\n"+`{"category": "laptops"}`+"\n")
+	writeTestFile(t, filepath.Join(w.dir, "notes.md"), "not a catalog")
+	writeTestFile(t, filepath.Join(w.dir, ".partial.csv"), "name\nHidden\n")
+
+	// The first poll only records the files, in case they are still being
+	// written.
+	w.poll()
+	if got := dirNames(t, w.dir); len(got) != 4 {
+		t.Fatalf("first poll moved files: %v", got)
+	}
+
+	w.poll()
+	if got, want := dirNames(t, w.dir), []string{".partial.csv", "notes.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("left in the directory %v, want %v", got, want)
+	}
+	if got, want := dirNames(t, w.archive), []string{"good.jsonl"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("archived %v, want %v", got, want)
+	}
+	if got, want := dirNames(t, w.quarantine), []string{"bad.jsonl", "bad.jsonl.job.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("quarantined %v, want %v", got, want)
+	}
+
+	// The report next to a quarantined file explains what went wrong.
+	reports, _ := filepath.Glob(filepath.Join(w.quarantine, "*.job.json"))
+	data, err := os.ReadFile(reports[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job IngestJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Source != "watch:bad.jsonl" || job.Inserted != 1 || job.Skipped != 1 {
+		t.Errorf("report %+v, want one inserted and one skipped", job)
+	}
+
+	// Valid records of a quarantined file are still ingested.
+	if count, _ := s.Count(context.Background(), nil); count != 2 {
+		t.Errorf("store holds %d products, want 2", count)
+	}
+}
+
+func TestDirWatcherWaitsForChanges(t *testing.T) {
+	useMemoryStore(t)
+	w := newTestWatcher(t)
+	path := filepath.Join(w.dir, "growing.csv")
+
+	writeTestFile(t, path, "name\nDell XPS 13\n")
+	w.poll()
+
+	// The file grew since the last poll, so it is not ingested yet.
+	writeTestFile(t, path, "name\nDell XPS 13\nMacBook Air\n")
+	w.poll()
+	if got := dirNames(t, w.archive); len(got) != 0 {
+		t.Fatalf("archived a file that was still changing: %v", got)
+	}
+
+	w.poll()
+	if got, want := dirNames(t, w.archive), []string{"growing.csv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("archived %v, want %v", got, want)
+	}
+}
+
+func TestDirWatcherQuarantinesUnreadableFiles(t *testing.T) {
+	useMemoryStore(t)
+	w := newTestWatcher(t)
+	writeTestFile(t, filepath.Join(w.dir, "broken.json"), `{"not": "an array"}`)
+
+	w.poll()
+	w.poll()
+
+	if got, want := dirNames(t, w.quarantine), []string{"broken.json", "broken.json.job.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("quarantined %v, want %v", got, want)
+	}
+}